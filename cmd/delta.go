@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"context"
+	"decompelf/src/decomp2dbg/client"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrNoState = errors.New("no symbol state, generate full symbol file with -state first")
+
+// deltaState is the last generated symbol set, persisted between runs with -state.
+type deltaState struct {
+	// Files are base symbol file and deltas stacked on it, removed deltas are empty.
+	Files   []string `json:"files"`
+	Symbols snapshot `json:"symbols"`
+	// Owners are indexes of files holding current names of symbols.
+	Owners map[string]int `json:"owners"`
+}
+
+func loadState(path string) (*deltaState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNoState, path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read symbol state: %w", err)
+	}
+
+	state := &deltaState{}
+	if err = json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse symbol state %s: %w", path, err)
+	}
+
+	if len(state.Files) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoState, path)
+	}
+
+	return state, nil
+}
+
+func (s *deltaState) save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return fmt.Errorf("failed to write symbol state: %w", err)
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// RunWithState generates full symbol file like Run and saves its symbol set into state for Delta.
+func RunWithState(ctx context.Context, cfg Config, d client.D2D, state string) error {
+	// taken first, symbols changed during generation get into the next delta
+	current, err := takeSnapshot(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	if err = Run(ctx, cfg, d); err != nil {
+		return err
+	}
+
+	out, err := filepath.Abs(cfg.Out)
+	if err != nil {
+		return err
+	}
+
+	owners := map[string]int{}
+	for key := range current {
+		owners[key] = 0
+	}
+
+	return (&deltaState{Files: []string{out}, Symbols: current, Owners: owners}).save(state)
+}
+
+// Delta writes symbols added or changed since the last generation saved in state into <base file>.deltaN
+// and gdb commands loading it into script, stdout if script is empty. Deltas without current symbol names
+// are unloaded by the same commands. Debug info and symbols of the base file are never reloaded,
+// old names of renamed symbols stay in it until the next full generation.
+func Delta(ctx context.Context, cfg Config, d client.D2D, statePath string, script string) error {
+	state, err := loadState(statePath)
+	if err != nil {
+		return err
+	}
+
+	current, err := takeSnapshot(ctx, d)
+	if err != nil {
+		return err
+	}
+
+	if len(current.diff(state.Symbols)) == 0 {
+		slog.Info("no changes since last generation", "state", statePath)
+		return nil
+	}
+
+	changed := map[string]bool{}
+	for key, sym := range current {
+		if prev, ok := state.Symbols[key]; !ok || prev != sym {
+			changed[key] = true
+		}
+	}
+
+	for key := range state.Symbols {
+		if _, ok := current[key]; !ok {
+			delete(state.Owners, key)
+		}
+	}
+
+	index := len(state.Files)
+	if len(changed) > 0 {
+		cfg.Out = fmt.Sprintf("%s.delta%d", state.Files[0], index)
+		cfg.Keep = func(kind string, address uint64) bool { return changed[symbolKey(kind, address)] }
+		// line table of the base file is kept
+		cfg.SourceDir = ""
+		if err = Run(ctx, cfg, d); err != nil {
+			return err
+		}
+
+		state.Files = append(state.Files, cfg.Out)
+		for key := range changed {
+			state.Owners[key] = index
+		}
+	}
+
+	live := map[int]bool{}
+	for _, i := range state.Owners {
+		live[i] = true
+	}
+
+	commands := []string{}
+	for i := 1; i < index; i++ {
+		if state.Files[i] != "" && !live[i] {
+			commands = append(commands, "remove-symbol-file "+state.Files[i])
+			state.Files[i] = ""
+		}
+	}
+
+	if len(changed) > 0 {
+		commands = append(commands, "add-symbol-file "+cfg.Out)
+		slog.Info("written", "path", cfg.Out, "symbols", len(changed))
+	}
+
+	state.Symbols = current
+	if err = state.save(statePath); err != nil {
+		return err
+	}
+
+	data := strings.Join(commands, "\n") + "\n"
+	if len(commands) == 0 {
+		data = ""
+	}
+
+	if script == "" {
+		fmt.Print(data)
+		return nil
+	}
+
+	if err = os.WriteFile(script, []byte(data), 0644); err != nil {
+		return fmt.Errorf("failed to write gdb script: %w", err)
+	}
+
+	return nil
+}
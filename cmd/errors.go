@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"decompelf/src/decomp2dbg/client"
+	"errors"
+	"log/slog"
+	"os"
+)
+
+const (
+	ExitError           = 1
+	ExitTransport       = 3
+	ExitHTTPStatus      = 4
+	ExitFault           = 5
+	ExitMalformed       = 6
+	ExitUnexpectedField = 7
+)
+
+// ExitCode maps decomp2dbg client errors to process exit codes.
+func ExitCode(err error) int {
+	code, _ := classify(err)
+	return code
+}
+
+func classify(err error) (int, string) {
+	var transport *client.TransportError
+	var status *client.HTTPStatusError
+	var fault *client.FaultError
+	var malformed *client.MalformedResponseError
+	var unexpected *client.UnexpectedFieldError
+
+	switch {
+	case errors.As(err, &transport):
+		return ExitTransport, "transport"
+	case errors.As(err, &status):
+		return ExitHTTPStatus, "http status"
+	case errors.As(err, &fault):
+		return ExitFault, "fault"
+	case errors.As(err, &malformed):
+		return ExitMalformed, "malformed response"
+	case errors.As(err, &unexpected):
+		return ExitUnexpectedField, "unexpected field"
+	}
+
+	return ExitError, "unknown"
+}
+
+func fatal(msg string, err error) {
+	code, c := classify(err)
+	slog.Error(msg, "error", err.Error(), "cause", c, "exit_code", code)
+	os.Exit(code)
+}
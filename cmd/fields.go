@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"decompelf/src/decomp2dbg/client"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fieldRe matches labels of struct fields and array elements, ex. Elf32_Ehdr_00010000.e_ident_pad[1],
+// Elf32_Phdr_ARRAY_00010028[6].p_paddr.
+var fieldRe = regexp.MustCompile(`^([^.\[\]]+)[.\[]`)
+
+// elementRe matches index of array element label with parent name removed, ex. [6].p_paddr.
+var elementRe = regexp.MustCompile(`^\[(\d+)\](.*)$`)
+
+// size returns size of global by its type or reported size, 0 if unknown.
+func (r *typeResolver) size(s *client.GlobalVar) uint64 {
+	if size := r.resolve(s.Type, s.Size).ByteSize(); size > 0 {
+		return size
+	}
+
+	return s.Size
+}
+
+// collapseFields replaces globals of struct fields and array elements with their parent global.
+// Field is collapsed only if parent exists at or below it and the field is inside of parent extent,
+// which is parent size or element stride times number of elements for arrays. Other labels like GCC
+// statics buf.1 are kept. Parent without known extent keeps zero size, it is inferred later.
+// Returns globals and removed fields.
+func collapseFields(gv []*client.GlobalVar, types *typeResolver) ([]*client.GlobalVar, []*client.GlobalVar) {
+	globals := []*client.GlobalVar{}
+	fields := []*client.GlobalVar{}
+	// index of parent in globals
+	parents := map[string]int{}
+	for _, s := range gv {
+		if !fieldRe.MatchString(s.Name) {
+			parents[s.Name] = len(globals)
+			globals = append(globals, s)
+		}
+	}
+
+	candidates := map[string][]*client.GlobalVar{}
+	for _, s := range gv {
+		m := fieldRe.FindStringSubmatch(s.Name)
+		if m == nil {
+			continue
+		}
+
+		if i, ok := parents[m[1]]; ok && globals[i].Value <= s.Value {
+			candidates[m[1]] = append(candidates[m[1]], s)
+		} else {
+			globals = append(globals, s)
+		}
+	}
+
+	for name, candidate := range candidates {
+		parent := globals[parents[name]]
+		size := types.size(parent)
+		if size == 0 {
+			size = arrayExtent(parent, candidate, types)
+
+			// client data is shared with later passes, sized parent is a copy
+			sized := *parent
+			sized.Size = size
+			globals[parents[name]] = &sized
+		}
+
+		for _, s := range candidate {
+			if s.Value < parent.Value+size {
+				fields = append(fields, s)
+			} else {
+				globals = append(globals, s)
+			}
+		}
+	}
+
+	sort.SliceStable(globals, func(i, j int) bool {
+		if globals[i].Value != globals[j].Value {
+			return globals[i].Value < globals[j].Value
+		}
+
+		return globals[i].Name < globals[j].Name
+	})
+
+	return globals, fields
+}
+
+// arrayExtent returns size of array parent as number of elements times element stride, 0 if unknown.
+// Stride is element type size or distance between the first and the last element labels.
+func arrayExtent(parent *client.GlobalVar, labels []*client.GlobalVar, types *typeResolver) uint64 {
+	count := uint64(0)
+	stride := uint64(0)
+	elements := map[uint64]*client.GlobalVar{}
+	for _, s := range labels {
+		m := elementRe.FindStringSubmatch(strings.TrimPrefix(s.Name, parent.Name))
+		if m == nil {
+			continue
+		}
+
+		index, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		count = max(count, index+1)
+
+		// element itself, not its field
+		if m[2] == "" {
+			elements[index] = s
+			stride = max(stride, types.size(s))
+		}
+	}
+
+	if stride == 0 && len(elements) > 1 {
+		lo, hi := uint64(math.MaxUint64), uint64(0)
+		for index := range elements {
+			lo, hi = min(lo, index), max(hi, index)
+		}
+
+		if distance := elements[hi].Value - elements[lo].Value; elements[hi].Value > elements[lo].Value && distance%(hi-lo) == 0 {
+			stride = distance / (hi - lo)
+		}
+	}
+
+	return count * stride
+}
@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"decompelf/src/decomp2dbg/client"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCollapseFields(t *testing.T) {
+	gv := []*client.GlobalVar{
+		// GCC statics are not fields of buf
+		{Name: "buf", Value: 0x100, Size: 4},
+		{Name: "buf.1", Value: 0x200},
+		{Name: "buf.2", Value: 0x300},
+		// parent of unknown size keeps its labels
+		{Name: "cfg", Value: 0x400},
+		{Name: "cfg.mode", Value: 0x404},
+		// fields inside parent are collapsed, labels after its end are kept
+		{Name: "hdr", Value: 0x500, Size: 52},
+		{Name: "hdr.e_type", Value: 0x510},
+		{Name: "hdr.e_ident_pad[1]", Value: 0x509},
+		{Name: "hdr.next", Value: 0x540},
+		// array extent is element count times stride
+		{Name: "arr", Value: 0x600},
+		{Name: "arr[0]", Value: 0x600},
+		{Name: "arr[1]", Value: 0x604},
+		{Name: "tbl", Value: 0x700},
+		{Name: "tbl[0]", Value: 0x700},
+		{Name: "tbl[1]", Value: 0x710},
+		{Name: "tbl[2].p_paddr", Value: 0x72c},
+		// no parent
+		{Name: "lost.field", Value: 0x800},
+		// label below parent
+		{Name: "late.x", Value: 0x8f0},
+		{Name: "late", Value: 0x900, Size: 8},
+	}
+
+	globals, fields := collapseFields(gv, newTypeResolver(nil, 8))
+
+	got := map[string]uint64{}
+	for _, s := range globals {
+		got[s.Name] = s.Size
+	}
+
+	want := map[string]uint64{
+		"buf": 4, "buf.1": 0, "buf.2": 0,
+		"cfg": 0, "cfg.mode": 0,
+		"hdr": 52, "hdr.next": 0,
+		"arr":        8,
+		"tbl":        48,
+		"lost.field": 0,
+		"late.x":     0, "late": 8,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("globals: got %v, want %v", got, want)
+	}
+
+	names := []string{}
+	for _, s := range fields {
+		names = append(names, s.Name)
+	}
+	sort.Strings(names)
+
+	wantFields := []string{"arr[0]", "arr[1]", "hdr.e_ident_pad[1]", "hdr.e_type", "tbl[0]", "tbl[1]", "tbl[2].p_paddr"}
+	if !reflect.DeepEqual(names, wantFields) {
+		t.Errorf("fields: got %v, want %v", names, wantFields)
+	}
+
+	// client data is not modified
+	for _, s := range gv {
+		if s.Name == "arr" && s.Size != 0 || s.Name == "tbl" && s.Size != 0 {
+			t.Errorf("%s: input size changed to %d", s.Name, s.Size)
+		}
+	}
+
+	for i := 1; i < len(globals); i++ {
+		if globals[i-1].Value > globals[i].Value {
+			t.Errorf("globals are not sorted: %s after %s", globals[i].Name, globals[i-1].Name)
+		}
+	}
+}
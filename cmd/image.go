@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"debug/elf"
+	"decompelf/src/tinyelf"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// addImage adds PT_LOAD segments with bytes of ELF file or raw dump at path, raw dump is loaded at image base.
+// Sections of ELF file or one section per segment are added if decompiler reported no memory blocks.
+func addImage(path string, t *tinyelf.TinyELF, imageBase uint64, slide uint64, haveSections bool) error {
+	f, err := elf.Open(path)
+	if err != nil {
+		var format *elf.FormatError
+		if !errors.As(err, &format) {
+			return fmt.Errorf("failed to open image: %w", err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read image: %w", err)
+		}
+
+		slog.Info("raw image", "path", path, "size", len(data), "address", fmt.Sprintf("0x%x", imageBase+slide))
+
+		t.AddSegment(&tinyelf.Segment{Addr: imageBase + slide, Data: data, Flags: elf.PF_R | elf.PF_W | elf.PF_X})
+		if !haveSections {
+			t.AddSection(segmentSection(0, imageBase+slide, uint64(len(data)), elf.PF_R|elf.PF_W|elf.PF_X))
+		}
+
+		return nil
+	}
+	defer f.Close()
+
+	// decompiler loads ELF at image base instead of the first segment address, ex. PIE at 0x100000
+	loads := []*elf.Prog{}
+	low := uint64(0)
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_LOAD {
+			continue
+		}
+
+		if len(loads) == 0 || p.Vaddr < low {
+			low = p.Vaddr
+		}
+		loads = append(loads, p)
+	}
+
+	delta := imageBase - low&^0xfff + slide
+
+	for i, p := range loads {
+		data, err := io.ReadAll(p.Open())
+		if err != nil {
+			return fmt.Errorf("failed to read image segment %d: %w", i, err)
+		}
+
+		t.AddSegment(&tinyelf.Segment{Addr: p.Vaddr + delta, Data: data, MemSize: p.Memsz, Flags: p.Flags, Align: p.Align})
+	}
+
+	slog.Info("elf image", "path", path, "segments", len(loads), "slide", fmt.Sprintf("0x%x", delta))
+
+	if f.Entry != 0 {
+		t.SetEntry(f.Entry + delta)
+	}
+
+	if haveSections {
+		return nil
+	}
+
+	sections := 0
+	for _, s := range f.Sections {
+		if s.Flags&elf.SHF_ALLOC == 0 || s.Size == 0 || s.Flags&elf.SHF_TLS != 0 && s.Type == elf.SHT_NOBITS {
+			continue
+		}
+
+		t.AddSection(&tinyelf.Section{
+			Name:      s.Name,
+			Type:      elf.SHT_NOBITS,
+			Flags:     s.Flags,
+			Addr:      s.Addr + delta,
+			Size:      s.Size,
+			Addralign: s.Addralign,
+			Entsize:   s.Entsize,
+		})
+		sections++
+	}
+
+	if sections == 0 {
+		for i, p := range loads {
+			t.AddSection(segmentSection(i, p.Vaddr+delta, p.Filesz, p.Flags))
+		}
+	}
+
+	return nil
+}
+
+// segmentSection returns section covering segment, named as in decompiler memory map.
+func segmentSection(i int, addr uint64, size uint64, flags elf.ProgFlag) *tinyelf.Section {
+	sectionFlags := elf.SHF_ALLOC
+	if flags&elf.PF_W != 0 {
+		sectionFlags |= elf.SHF_WRITE
+	}
+	if flags&elf.PF_X != 0 {
+		sectionFlags |= elf.SHF_EXECINSTR
+	}
+
+	return &tinyelf.Section{Name: fmt.Sprintf("segment_%d", i), Type: elf.SHT_NOBITS, Flags: sectionFlags, Addr: addr, Size: size, Addralign: 1}
+}
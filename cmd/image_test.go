@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bytes"
+	"debug/elf"
+	"decompelf/src/tinyelf"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeImage writes ELF with two PT_LOAD segments, the first one does not start at page boundary.
+func writeImage(t *testing.T, sections bool) (string, [][]byte) {
+	path := filepath.Join(t.TempDir(), "image")
+	code := bytes.Repeat([]byte{0x90}, 0x40)
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	e := tinyelf.New64(path, elf.EM_X86_64, 0, binary.LittleEndian, uint(elf.ET_EXEC))
+	e.AddSegment(&tinyelf.Segment{Addr: 0x400100, Data: code, Flags: elf.PF_R | elf.PF_X})
+	e.AddSegment(&tinyelf.Segment{Addr: 0x401000, Data: data, MemSize: 0x100, Flags: elf.PF_R | elf.PF_W})
+	e.SetEntry(0x400110)
+	if sections {
+		e.AddSection(&tinyelf.Section{Name: ".init", Flags: elf.SHF_ALLOC | elf.SHF_EXECINSTR, Addr: 0x400120, Data: code[0x20:], Addralign: 4})
+	}
+
+	if err := e.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	return path, [][]byte{code, data}
+}
+
+// image writes ELF made by addImage and opens it.
+func image(t *testing.T, path string, slide uint64, haveSections bool) *elf.File {
+	out := filepath.Join(t.TempDir(), "out")
+	e := tinyelf.New64(out, elf.EM_X86_64, 0, binary.LittleEndian, uint(elf.ET_EXEC))
+	if err := addImage(path, e, 0x100000, slide, haveSections); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := e.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	return open(t, out)
+}
+
+type load struct {
+	vaddr  uint64
+	filesz uint64
+	memsz  uint64
+	flags  elf.ProgFlag
+}
+
+func checkLoads(t *testing.T, f *elf.File, want []load, contents [][]byte) {
+	loads := []*elf.Prog{}
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD {
+			loads = append(loads, p)
+		}
+	}
+
+	if len(loads) != len(want) {
+		t.Fatalf("got %d PT_LOAD, want %d", len(loads), len(want))
+	}
+
+	for i, w := range want {
+		p := loads[i]
+		if p.Vaddr != w.vaddr || p.Filesz != w.filesz || p.Memsz != w.memsz || p.Flags != w.flags {
+			t.Errorf("PT_LOAD %d: got vaddr 0x%x filesz 0x%x memsz 0x%x %s, want %+v", i, p.Vaddr, p.Filesz, p.Memsz, p.Flags, w)
+		}
+
+		// offset is congruent to address modulo alignment
+		if p.Off%p.Align != p.Vaddr%p.Align {
+			t.Errorf("PT_LOAD %d: offset 0x%x does not match address 0x%x, align 0x%x", i, p.Off, p.Vaddr, p.Align)
+		}
+
+		if got, _ := io.ReadAll(p.Open()); !bytes.Equal(got, contents[i]) {
+			t.Errorf("PT_LOAD %d: got %x", i, got)
+		}
+	}
+}
+
+func TestAddImage(t *testing.T) {
+	path, contents := writeImage(t, false)
+
+	// image base is the page of the lowest segment, slide moves it
+	for _, slide := range []uint64{0, 0x2000} {
+		f := image(t, path, slide, false)
+		checkLoads(t, f, []load{
+			{0x100100 + slide, 0x40, 0x40, elf.PF_R | elf.PF_X},
+			{0x101000 + slide, 8, 0x100, elf.PF_R | elf.PF_W},
+		}, contents)
+
+		if f.Entry != 0x100110+slide {
+			t.Errorf("slide 0x%x: entry: got 0x%x", slide, f.Entry)
+		}
+
+		// image without sections gets one per segment, with segment bytes
+		for i, name := range []string{"segment_0", "segment_1"} {
+			s := f.Section(name)
+			if s == nil || s.Addr != f.Progs[i].Vaddr || s.Type != elf.SHT_PROGBITS {
+				t.Errorf("slide 0x%x: %s: got %+v", slide, name, s)
+				continue
+			}
+
+			if data, _ := s.Data(); !bytes.Equal(data, contents[i]) {
+				t.Errorf("slide 0x%x: %s: got %x", slide, name, data)
+			}
+		}
+
+		if s := f.Section("segment_0"); s != nil && s.Flags != elf.SHF_ALLOC|elf.SHF_EXECINSTR {
+			t.Errorf("segment_0 flags: got %s", s.Flags)
+		}
+	}
+}
+
+func TestAddImageSections(t *testing.T) {
+	path, _ := writeImage(t, true)
+
+	f := image(t, path, 0x1000, false)
+	s := f.Section(".init")
+	if s == nil || s.Addr != 0x101120 || s.Size != 0x20 || s.Flags != elf.SHF_ALLOC|elf.SHF_EXECINSTR {
+		t.Errorf(".init: got %+v", s)
+	}
+
+	if f.Section("segment_0") != nil {
+		t.Errorf("segment sections are added to image with sections")
+	}
+
+	// decompiler memory blocks are used instead
+	if f = image(t, path, 0, true); f.Section(".init") != nil || f.Section("segment_0") != nil {
+		t.Errorf("image sections are added with memory blocks")
+	}
+}
+
+func TestAddRawImage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.bin")
+	dump := []byte("\x00\x01raw memory dump")
+	if err := os.WriteFile(path, dump, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := image(t, path, 0x3000, false)
+	checkLoads(t, f, []load{{0x103000, uint64(len(dump)), uint64(len(dump)), elf.PF_R | elf.PF_W | elf.PF_X}}, [][]byte{dump})
+
+	if s := f.Section("segment_0"); s == nil || s.Addr != 0x103000 || s.Size != uint64(len(dump)) {
+		t.Errorf("segment_0: got %+v", s)
+	}
+}
@@ -1,35 +1,105 @@
 package cmd
 
 import (
+	"context"
 	"debug/elf"
 	"decompelf/src/decomp2dbg/client"
 	"decompelf/src/tinyelf"
 	"encoding/binary"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
+	"math"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
+var (
+	ErrPing  = errors.New("decomp2dbg server ping reply is false")
+	ErrSizes = errors.New("-sizes must be trust or infer")
+	ErrNames = errors.New("-names must be raw, dedup or gdb")
+)
+
+type Config struct {
+	URL          string
+	Out          string
+	Machine      string
+	Flags        string
+	ByteOrder    string
+	Arch         int
+	ElfType      int
+	SourceDir    string
+	DWARF        bool
+	Vars         bool
+	Types        bool
+	LoadBase     string
+	Slide        string
+	PID          int
+	Core         string
+	RSP          string
+	RSPCheck     string
+	Image        string
+	AutoLocal    bool
+	Sizes        string
+	FieldAliases bool
+	Names        string
+	RenameReport string
+	Mangle       bool
+	BuildID      string
+	DebugLink    string
+	Provenance   bool
+	Time         time.Time
+	// Keep selects symbols written by kind and decompiler address, nil keeps all.
+	Keep func(kind string, address uint64) bool
+}
+
 func Start() {
-	var url string
-	var filename string
-	var fMachine string
-	var flags string
-	var fByteOrder string
-	var arch int
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		Serve(os.Args[2:])
+		return
+	}
+
+	cfg := Config{}
 	var list bool
-	var elfType int
-	flag.StringVar(&url, "url", "http://localhost:3662/RPC2", "decomp2dbg server url")
-	flag.StringVar(&filename, "out", "/tmp/tinyelf", "")
-	flag.StringVar(&fMachine, "machine", "", "ex. X86_64")
-	flag.StringVar(&flags, "flags", "", "ELF flags, ex. 0x0")
-	flag.StringVar(&fByteOrder, "byteorder", "l", "l - little endian, b - big endian")
-	flag.IntVar(&arch, "arch", 0, "32 or 64 bit")
+	var record string
+	var replay string
+	var watch time.Duration
+	var gdbScript string
+	var state string
+	var delta bool
+	flag.StringVar(&cfg.URL, "url", "http://localhost:3662/RPC2", "decomp2dbg server url")
+	flag.StringVar(&cfg.Out, "out", "/tmp/tinyelf", "")
+	flag.StringVar(&cfg.Machine, "machine", "", "ex. X86_64")
+	flag.StringVar(&cfg.Flags, "flags", "", "ELF flags, ex. 0x0")
+	flag.StringVar(&cfg.ByteOrder, "byteorder", "l", "l - little endian, b - big endian")
+	flag.IntVar(&cfg.Arch, "arch", 0, "32 or 64 bit")
 	flag.BoolVar(&list, "l", false, "list all machines")
-	flag.IntVar(&elfType, "elftype", int(elf.ET_REL), "https://pkg.go.dev/debug/elf#Type")
+	flag.IntVar(&cfg.ElfType, "elftype", int(elf.ET_REL), "https://pkg.go.dev/debug/elf#Type")
+	c := clientFlags(flag.CommandLine)
+	outputFlags(flag.CommandLine, &cfg)
+	flag.StringVar(&cfg.LoadBase, "load-base", "", "runtime address of decompiler image base, ex. 0x555555554000")
+	flag.StringVar(&cfg.Slide, "slide", "", "offset added to decompiler addresses, ex. 0x1000 or -0x1000")
+	flag.IntVar(&cfg.PID, "pid", 0, "detect load base from /proc/<pid>/maps")
+	flag.StringVar(&cfg.Core, "core", "", "detect load base from core file")
+	flag.StringVar(&cfg.RSP, "rsp", "", "get section offsets from gdbserver or QEMU stub at host:port")
+	flag.StringVar(&cfg.RSPCheck, "rsp-check", "", "check function bytes in target memory with -rsp, ex. main:554889e5")
+	flag.StringVar(&cfg.Image, "image", "", "original binary or raw memory dump, makes loadable ELF with program headers and real bytes")
+	flag.StringVar(&cfg.RenameReport, "rename-report", "", "write renamed symbols into file")
+	flag.StringVar(&cfg.BuildID, "build-id", "", "add .note.gnu.build-id: auto - hash of generated file, hex:<id> - literal value, [file:]<path> - copy it from binary")
+	flag.StringVar(&cfg.DebugLink, "debuglink", "", "add .gnu_debuglink pointing to file")
+	flag.StringVar(&cfg.SourceDir, "source", "", "write decompiled source into directory and emit DWARF line table")
+	flag.StringVar(&record, "record", "", "save decomp2dbg requests and responses into directory")
+	flag.DurationVar(&watch, "watch", 0, "poll decomp2dbg server at interval and rewrite output when functions or globals change")
+	flag.StringVar(&gdbScript, "gdb-script", "", "with -watch, write gdb script reloading output file, with -delta, write commands loading the delta, use with gdb source command")
+	flag.StringVar(&state, "state", "", "save generated symbol set into file for -delta")
+	flag.BoolVar(&delta, "delta", false, "write only symbols added or changed since -state into <output>.deltaN and print gdb commands loading it")
+	flag.StringVar(&replay, "replay", "", "serve decomp2dbg responses from directory saved with -record instead of contacting server")
 	flag.Parse()
 
 	if list {
@@ -37,44 +107,161 @@ func Start() {
 		os.Exit(0)
 	}
 
-	c := client.Client{URL: url}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	checkClientFlags(c)
+
+	if record != "" && replay != "" {
+		slog.Error("-record and -replay are mutually exclusive")
+		os.Exit(2)
+	}
+
+	if delta && (state == "" || watch > 0) {
+		slog.Error("-delta requires -state and cannot be used with -watch")
+		os.Exit(2)
+	}
+
+	var transport http.RoundTripper = http.DefaultTransport
+	var err error
+	if record != "" {
+		if transport, err = client.NewRecordTransport(record, transport); err != nil {
+			fatal("failed to start recording", err)
+		}
+	}
+
+	var replayTransport *client.ReplayTransport
+	if replay != "" {
+		if replayTransport, err = client.NewReplayTransport(replay); err != nil {
+			fatal("failed to load recorded session", err)
+		}
+		transport = replayTransport
+	}
+	cfg.Time = generationTime(replayTransport)
+
+	c.URL = cfg.URL
+	c.HTTPClient = &http.Client{Transport: transport}
+
+	if watch > 0 {
+		if err = Watch(ctx, cfg, c, watch, gdbScript); err != nil {
+			fatal("failed to create tiny elf", err)
+		}
+
+		return
+	}
+
+	switch {
+	case delta:
+		err = Delta(ctx, cfg, c, state, gdbScript)
+	case state != "":
+		err = RunWithState(ctx, cfg, c, state)
+	default:
+		err = Run(ctx, cfg, c)
+	}
 
-	reply, err := c.Ping()
 	if err != nil {
-		slog.Error("failed to ping decomp2dbg server", "error", err.Error())
-		os.Exit(1)
+		fatal("failed to create tiny elf", err)
 	}
 
-	if reply.Params.Param.Value.Boolean != "1" {
-		slog.Error("decomp2dbg server ping reply is false")
-		os.Exit(1)
+	slog.Info("done")
+}
+
+// clientFlags registers decomp2dbg client options in fs.
+func clientFlags(fs *flag.FlagSet) *client.Client {
+	c := &client.Client{}
+	fs.DurationVar(&c.Timeout, "timeout", 30*time.Second, "decomp2dbg request timeout, 0 - no timeout")
+	fs.IntVar(&c.Retries, "retries", 2, "number of retries for failed decomp2dbg requests")
+	fs.DurationVar(&c.RetryBackoff, "retry-backoff", client.DefaultRetryBackoff, "delay before first retry, doubled on each next one")
+	fs.Int64Var(&c.MaxResponseSize, "max-response-size", client.DefaultMaxResponseSize, "maximum decomp2dbg response size in bytes")
+
+	return c
+}
+
+// checkClientFlags exits with usage error if client options parsed by clientFlags are invalid.
+func checkClientFlags(c *client.Client) {
+	if c.Retries < 0 {
+		slog.Error("-retries must not be negative", "retries", c.Retries)
+		os.Exit(2)
+	}
+}
+
+// outputFlags registers options of generated symbols and debug info in fs.
+func outputFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.BoolVar(&cfg.DWARF, "dwarf", true, "emit DWARF debug info for functions")
+	fs.BoolVar(&cfg.Vars, "vars", false, "emit DWARF function arguments and local variables, requires -dwarf")
+	fs.BoolVar(&cfg.Types, "types", true, "fetch decompiler data types for globals and variables")
+	fs.BoolVar(&cfg.AutoLocal, "auto-local", true, "emit decompiler generated names like FUN_00101000 as local symbols")
+	fs.StringVar(&cfg.Sizes, "sizes", "infer", "trust - use decompiler symbol sizes, infer - fill missing sizes up to the next symbol")
+	fs.BoolVar(&cfg.FieldAliases, "field-aliases", false, "keep struct field and array element labels like hdr.e_type as local symbols")
+	fs.StringVar(&cfg.Names, "names", NamesDedup, "symbol naming: raw - as in decompiler, dedup - add address to duplicate names, gdb - dedup and replace characters which need quoting in gdb")
+	fs.BoolVar(&cfg.Mangle, "mangle", false, "write namespaced names like ns::A::f as Itanium C++ mangled symbols")
+	fs.BoolVar(&cfg.Provenance, "provenance", true, "add note with decompiled program, image base, server url and generation time")
+}
+
+// generationTime returns time of recording for replayed sessions (zero if unknown) or current time, SOURCE_DATE_EPOCH overrides both.
+func generationTime(replay *client.ReplayTransport) time.Time {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		if sec, err := strconv.ParseInt(epoch, 10, 64); err == nil {
+			return time.Unix(sec, 0)
+		}
+	}
+
+	if replay != nil {
+		return replay.Recorded
 	}
 
-	elfInfo, err := c.ElfInfo()
+	return time.Now()
+}
+
+// Run fetches symbols from decomp2dbg server and writes them to cfg.Out.
+func Run(ctx context.Context, cfg Config, d client.D2D) error {
+	switch cfg.Sizes {
+	case "":
+		cfg.Sizes = "infer"
+	case "trust", "infer":
+	default:
+		return ErrSizes
+	}
+
+	switch cfg.Names {
+	case "":
+		cfg.Names = NamesDedup
+	case NamesRaw, NamesDedup, NamesGDB:
+	default:
+		return ErrNames
+	}
+
+	pong, err := d.Ping(ctx)
 	if err != nil {
-		slog.Error("failed to get elf info from decomp2dbg", "error", err.Error())
-		os.Exit(1)
+		return fmt.Errorf("failed to ping decomp2dbg server: %w", err)
+	}
+
+	if !pong {
+		return ErrPing
+	}
+
+	elfInfo, err := d.ElfInfo(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get elf info from decomp2dbg: %w", err)
 	}
 
 	var mach Machine
 	var ok bool
-	if fMachine != "" {
-		if mach, ok = Machines[strings.ToLower(fMachine)]; !ok {
-			slog.Error("invalid machine, call decompelf -l to list all machines", "machine", fMachine)
-			os.Exit(1)
+	if cfg.Machine != "" {
+		if mach, ok = Machines[strings.ToLower(cfg.Machine)]; !ok {
+			return fmt.Errorf("invalid machine %s, call decompelf -l to list all machines", cfg.Machine)
 		}
 	} else {
 		if mach, ok = MachinesByID[elfInfo.Machine]; !ok {
-			slog.Error("invalid machine from decomp2dbg", "machine", fMachine)
-			os.Exit(1)
+			return fmt.Errorf("invalid machine from decomp2dbg: %d", elfInfo.Machine)
 		}
 	}
 
 	var flagsInt int64
-	if flags == "" {
+	if cfg.Flags == "" {
 		flagsInt = int64(elfInfo.Flags)
 	} else {
-		flags, _ = strings.CutPrefix(flags, "0x")
+		flags, _ := strings.CutPrefix(cfg.Flags, "0x")
 		flagsInt, err = strconv.ParseInt(flags, 16, 32)
 		if err != nil {
 			slog.Error("failed to parse flags into hex", "flag", flags, "using flags", flagsInt)
@@ -82,61 +269,226 @@ func Start() {
 	}
 
 	var byteOrder binary.ByteOrder = binary.LittleEndian
-	if fByteOrder == "" {
+	if cfg.ByteOrder == "" {
 		if elfInfo.IsBigEndian {
 			byteOrder = binary.BigEndian
 		}
 	} else {
-		if fByteOrder == "b" {
+		if cfg.ByteOrder == "b" {
 			byteOrder = binary.BigEndian
 		}
 	}
 
 	var t *tinyelf.TinyELF
 	var is32 bool
-	if arch == 0 {
+	if cfg.Arch == 0 {
 		is32 = elfInfo.Is32Bit
 	} else {
-		is32 = arch == 32
+		is32 = cfg.Arch == 32
 	}
 
 	slog.Info("new tinyelf", "filename", elfInfo.Name, "machine_id", int(mach.Value), "machine_name", mach.Name, "machine_comment", mach.Comment,
 		"is_32bit", is32, "flags", fmt.Sprintf("0x%02x", flagsInt), "byteorder", byteOrder, "image_base", fmt.Sprintf("0x%02x", elfInfo.ImageBase))
 
+	elfType := cfg.ElfType
+	if cfg.Image != "" && elfType == int(elf.ET_REL) {
+		slog.Info("loadable ELF with -image, using ET_EXEC")
+		elfType = int(elf.ET_EXEC)
+	}
+
 	if is32 {
-		t = tinyelf.New32(filename, mach.Value, uint32(flagsInt), byteOrder, uint(elfType))
+		t = tinyelf.New32(cfg.Out, mach.Value, uint32(flagsInt), byteOrder, uint(elfType))
 	} else {
-		t = tinyelf.New64(filename, mach.Value, uint32(flagsInt), byteOrder, uint(elfType))
+		t = tinyelf.New64(cfg.Out, mach.Value, uint32(flagsInt), byteOrder, uint(elfType))
 	}
 
-	fh, err := c.FunctionHeaders()
+	fh, err := d.FunctionHeaders(ctx)
 	if err != nil {
-		slog.Error("failed to get function headers", "error", err.Error())
-		os.Exit(1)
+		return fmt.Errorf("failed to get function headers: %w", err)
 	}
 
 	slog.Info("function headers", "total", len(fh))
 
-	gv, err := c.GlobalVars()
+	gv, err := d.GlobalVars(ctx)
 	if err != nil {
-		slog.Error("failed to get global vars", "error", err.Error())
-		os.Exit(1)
+		return fmt.Errorf("failed to get global vars: %w", err)
 	}
 
 	slog.Info("global vars", "total", len(gv))
 
+	types, err := dataTypes(ctx, d, cfg, is32)
+	if err != nil {
+		return err
+	}
+
+	slide, err := loadSlide(ctx, cfg, elfInfo, fh)
+	if err != nil {
+		return err
+	}
+
+	if slide != 0 {
+		slog.Info("rebasing", "image_base", fmt.Sprintf("0x%x", elfInfo.ImageBase), "load_base", fmt.Sprintf("0x%x", elfInfo.ImageBase+slide))
+	}
+	t.Rebase(elfInfo.ImageBase, slide)
+
+	blocks, err := addMemoryBlocks(ctx, d, t, slide)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Image != "" {
+		if err = addImage(cfg.Image, t, elfInfo.ImageBase, slide, blocks > 0); err != nil {
+			return err
+		}
+	}
+
+	// tinyelf has no call frame information, CFA is available only from target
+	cfi := t.HasSection(".eh_frame") || t.HasSection(".debug_frame")
+	if cfg.DWARF && cfg.Vars && !cfi {
+		slog.Warn("no .eh_frame or .debug_frame in memory map, stack variables are relative to stack pointer and valid at function entry only")
+	}
+
+	names := newNamer(cfg.Names)
 	for _, s := range fh {
-		t.AddSymbol(s.Name, s.Value, s.Size, elf.STT_FUNC)
+		if is32 && s.Value > math.MaxUint32 {
+			slog.Warn("function address does not fit into ELF32, truncated", "name", s.Name, "address", fmt.Sprintf("0x%x", s.Value))
+		}
+
+		var data *client.FunctionData
+		if cfg.DWARF && cfg.Vars || cfg.Mangle && strings.Contains(s.Name, "::") {
+			if data, err = functionData(ctx, d, s); err != nil {
+				return err
+			}
+		}
+
+		name, mangled := s.Name, false
+		if cfg.Mangle {
+			var args []*client.Variable
+			if data != nil {
+				args = data.Args
+			}
+			name, mangled = mangle(s.Name, args, types.known)
+		}
+
+		// DWARF keeps qualified name
+		name = names.name(name, s.Value)
+		dwarfName := name
+		if mangled {
+			dwarfName = s.Name
+		}
+
+		bind := binding(s.Name, cfg.AutoLocal)
+		t.AddSymbolEntry(&tinyelf.Symbol{Name: name, Value: s.Value, Size: s.Size, Type: elf.STT_FUNC, Bind: bind})
+
+		if cfg.DWARF {
+			f := &tinyelf.Function{Name: dwarfName, LowPC: s.Value, HighPC: s.Value + s.Size, Static: bind == elf.STB_LOCAL}
+			if cfg.Vars && data != nil {
+				addFunctionData(data, f, mach.Value, types, cfi)
+			}
+
+			t.AddFunction(f)
+		}
+	}
+
+	gv, fields := collapseFields(gv, types)
+	if len(fields) > 0 {
+		slog.Info("collapsed struct fields and array elements", "fields", len(fields))
 	}
 
 	for _, s := range gv {
-		t.AddSymbol(s.Name, s.Value, 8, elf.STT_OBJECT)
+		if is32 && s.Value > math.MaxUint32 {
+			slog.Warn("global var address does not fit into ELF32, truncated", "name", s.Name, "address", fmt.Sprintf("0x%x", s.Value))
+		}
+
+		typ := types.resolve(s.Type, s.Size)
+		// unknown size is inferred later
+		size := max(typ.ByteSize(), s.Size)
+		if size == 0 && cfg.Sizes == "trust" {
+			size = 8
+		}
+
+		name, mangled := s.Name, false
+		if cfg.Mangle {
+			name, mangled = mangle(s.Name, nil, types.known)
+		}
+
+		name = names.name(name, s.Value)
+		dwarfName := name
+		if mangled {
+			dwarfName = s.Name
+		}
+
+		bind := binding(s.Name, cfg.AutoLocal)
+		t.AddSymbolEntry(&tinyelf.Symbol{Name: name, Value: s.Value, Size: size, Type: elf.STT_OBJECT, Bind: bind})
+
+		if cfg.DWARF && typ != nil {
+			t.AddGlobal(&tinyelf.Global{Name: dwarfName, Address: s.Value, Type: typ, Static: bind == elf.STB_LOCAL})
+		}
+	}
+
+	var overlaps []tinyelf.Overlap
+	if cfg.Sizes == "infer" {
+		overlaps = t.InferSizes()
+	} else {
+		overlaps = t.Overlaps()
+	}
+
+	for _, o := range overlaps {
+		slog.Warn("symbols overlap", "section", o.Section,
+			"first", o.First.Name, "first_address", fmt.Sprintf("0x%x", o.First.Value), "first_size", o.First.Size,
+			"second", o.Second.Name, "second_address", fmt.Sprintf("0x%x", o.Second.Value), "second_size", o.Second.Size)
+	}
+
+	// added after size pass, aliases overlap their parents
+	if cfg.FieldAliases {
+		for _, s := range fields {
+			t.AddSymbolEntry(&tinyelf.Symbol{Name: names.name(s.Name, s.Value), Value: s.Value, Size: types.size(s), Type: elf.STT_OBJECT, Bind: elf.STB_LOCAL})
+		}
+	}
+
+	if cfg.Keep != nil {
+		t.Retain(func(s *tinyelf.Symbol) bool {
+			kind := "global"
+			if s.Type == elf.STT_FUNC {
+				kind = "function"
+			}
+
+			return cfg.Keep(kind, s.Value-slide)
+		})
+	}
+
+	if len(names.renames) > 0 {
+		slog.Info("renamed symbols", "total", len(names.renames), "names", cfg.Names)
+	}
+
+	if cfg.RenameReport != "" {
+		if err = names.writeReport(cfg.RenameReport); err != nil {
+			return err
+		}
+	}
+
+	if cfg.SourceDir != "" {
+		dir, err := filepath.Abs(cfg.SourceDir)
+		if err != nil {
+			return err
+		}
+
+		src, err := decompileAll(ctx, d, fh, filepath.Join(dir, filepath.Base(elfInfo.Name)+".c"))
+		if err != nil {
+			return err
+		}
+
+		slog.Info("decompiled source", "path", src.Path, "functions", len(src.Sequences))
+		t.AddSource(src)
+	}
+
+	if err = addNotes(cfg, t, elfInfo); err != nil {
+		return err
 	}
 
 	if err = t.Write(); err != nil {
-		slog.Error("failed to save tiny elf", "filename", filename, "error", err.Error())
-		os.Exit(1)
+		return fmt.Errorf("failed to save tiny elf %s: %w", cfg.Out, err)
 	}
 
-	slog.Info("done")
+	return nil
 }
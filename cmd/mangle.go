@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"decompelf/src/decomp2dbg/client"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var identifierRe = regexp.MustCompile(`^~?[A-Za-z_][A-Za-z0-9_]*$`)
+
+// builtinTypes are Itanium C++ ABI codes of C and Ghidra base types.
+var builtinTypes = map[string]string{
+	"void":               "v",
+	"bool":               "b",
+	"char":               "c",
+	"wchar_t":            "w",
+	"signed char":        "a",
+	"schar":              "a",
+	"sbyte":              "a",
+	"unsigned char":      "h",
+	"uchar":              "h",
+	"byte":               "h",
+	"undefined":          "h",
+	"undefined1":         "h",
+	"short":              "s",
+	"unsigned short":     "t",
+	"ushort":             "t",
+	"word":               "t",
+	"undefined2":         "t",
+	"int":                "i",
+	"unsigned int":       "j",
+	"uint":               "j",
+	"dword":              "j",
+	"undefined4":         "j",
+	"long":               "l",
+	"unsigned long":      "m",
+	"ulong":              "m",
+	"long long":          "x",
+	"longlong":           "x",
+	"unsigned long long": "y",
+	"ulonglong":          "y",
+	"qword":              "y",
+	"undefined8":         "y",
+	"float":              "f",
+	"double":             "d",
+	"long double":        "e",
+	"longdouble":         "e",
+}
+
+// mangler writes Itanium C++ ABI names, components already written are replaced with substitutions.
+type mangler struct {
+	buf   strings.Builder
+	subs  []string
+	known map[string]*client.DataType
+}
+
+// mangle returns Itanium C++ ABI name of namespaced decompiler name, ex. ns::A::f with int argument
+// becomes _ZN2ns1A1fEi. args are function arguments, nil for globals and functions without data.
+// Names without namespace, with templates or operators are not mangled.
+func mangle(name string, args []*client.Variable, known map[string]*client.DataType) (string, bool) {
+	parts := strings.Split(name, "::")
+	if len(parts) < 2 {
+		return name, false
+	}
+
+	for i, p := range parts {
+		dtor := i == len(parts)-1 && p == "~"+parts[i-1]
+		if !identifierRe.MatchString(p) || strings.HasPrefix(p, "~") && !dtor {
+			return name, false
+		}
+	}
+
+	m := &mangler{known: known}
+	m.buf.WriteString("_Z")
+	m.name(parts, false)
+
+	if args == nil {
+		return m.buf.String(), true
+	}
+
+	written := 0
+	for _, a := range args {
+		// implicit object parameter is not mangled
+		if a.Name == "this" && written == 0 {
+			continue
+		}
+
+		// top-level qualifiers are not part of function type
+		typ, _ := unqualified(decay(a.Type))
+
+		if !m.typ(typ, 0) {
+			return mangle(name, nil, known)
+		}
+		written++
+	}
+
+	if written == 0 {
+		m.buf.WriteString("v")
+	}
+
+	return m.buf.String(), true
+}
+
+// sub writes substitution of component key if it was written before.
+func (m *mangler) sub(key string) bool {
+	for i, s := range m.subs {
+		if s != key {
+			continue
+		}
+
+		if i == 0 {
+			m.buf.WriteString("S_")
+		} else {
+			m.buf.WriteString("S" + strings.ToUpper(strconv.FormatInt(int64(i-1), 36)) + "_")
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// name writes nested name, the last component is a substitution candidate for types only.
+func (m *mangler) name(parts []string, isType bool) {
+	if isType && m.sub(strings.Join(parts, "::")) {
+		return
+	}
+
+	n := len(parts)
+	if n > 1 {
+		m.buf.WriteString("N")
+	}
+
+	i := 0
+	for j := n - 1; j > 0; j-- {
+		if m.sub(strings.Join(parts[:j], "::")) {
+			i = j
+			break
+		}
+	}
+
+	for ; i < n; i++ {
+		p := parts[i]
+		switch {
+		case !isType && i == n-1 && i > 0 && p == parts[i-1]:
+			m.buf.WriteString("C1")
+		case !isType && i == n-1 && i > 0 && p == "~"+parts[i-1]:
+			m.buf.WriteString("D1")
+		default:
+			m.buf.WriteString(strconv.Itoa(len(p)) + p)
+		}
+
+		if i < n-1 || isType {
+			m.subs = append(m.subs, strings.Join(parts[:i+1], "::"))
+		}
+	}
+
+	if n > 1 {
+		m.buf.WriteString("E")
+	}
+}
+
+// typ writes type by decompiler name, arrays decay to pointers, typedefs are resolved.
+func (m *mangler) typ(name string, depth int) bool {
+	name = strings.TrimSpace(name)
+	if depth > 16 || name == "" {
+		return false
+	}
+
+	if code, ok := builtinTypes[name]; ok {
+		m.buf.WriteString(code)
+		return true
+	}
+
+	name = decay(name)
+	// qualifiers of pointer apply to it, qualifiers of base type go to pointee
+	if inner, ok := unqualified(name); ok {
+		return m.compound("K", inner, depth)
+	}
+
+	if inner, code, ok := pointee(name); ok {
+		return m.compound(code, inner, depth)
+	}
+
+	if dt, ok := m.known[name]; ok {
+		switch dt.Kind {
+		case client.KindTypedef:
+			return m.typ(dt.Target, depth+1)
+		case client.KindPointer:
+			return m.typ(dt.Target+" *", depth+1)
+		case client.KindArray:
+			return m.typ(dt.Target+" *", depth+1)
+		case client.KindBase:
+			if code := baseCode(dt); code != "" {
+				m.buf.WriteString(code)
+				return true
+			}
+		}
+	}
+
+	parts := strings.Split(name, "::")
+	for _, p := range parts {
+		if !identifierRe.MatchString(p) || strings.HasPrefix(p, "~") {
+			return false
+		}
+	}
+	m.name(parts, true)
+
+	return true
+}
+
+// compound writes qualified, pointer or reference type, written before ones are replaced with substitutions.
+func (m *mangler) compound(code string, inner string, depth int) bool {
+	key := code + canonical(inner)
+	if m.sub(key) {
+		return true
+	}
+
+	m.buf.WriteString(code)
+	if !m.typ(inner, depth+1) {
+		return false
+	}
+	m.subs = append(m.subs, key)
+
+	return true
+}
+
+// decay returns pointer type of array parameter.
+func decay(name string) string {
+	name = strings.TrimSpace(name)
+	if a := arrayRe.FindStringSubmatch(name); a != nil {
+		return a[1] + " *"
+	}
+
+	return name
+}
+
+// unqualified returns type without top-level const, ex. char * for char * const and char for const char.
+func unqualified(name string) (string, bool) {
+	if inner, ok := strings.CutSuffix(name, "const"); ok && (inner == "" || strings.ContainsAny(inner[len(inner)-1:], " *&")) {
+		return strings.TrimSpace(inner), true
+	}
+
+	if _, _, ok := pointee(name); ok {
+		return name, false
+	}
+
+	if inner, ok := strings.CutPrefix(name, "const "); ok {
+		return strings.TrimSpace(inner), true
+	}
+
+	return name, false
+}
+
+// pointee returns pointed type and Itanium C++ ABI code of pointer or reference type.
+func pointee(name string) (string, string, bool) {
+	switch {
+	case strings.HasSuffix(name, "*"):
+		return strings.TrimSpace(name[:len(name)-1]), "P", true
+	case strings.HasSuffix(name, "&&"):
+		return strings.TrimSpace(name[:len(name)-2]), "O", true
+	case strings.HasSuffix(name, "&"):
+		return strings.TrimSpace(name[:len(name)-1]), "R", true
+	}
+
+	return name, "", false
+}
+
+// canonical returns substitution key of type, the same for different spellings like char const * and const char*.
+func canonical(name string) string {
+	name = decay(name)
+	if inner, ok := unqualified(name); ok {
+		return "K" + canonical(inner)
+	}
+
+	if inner, code, ok := pointee(name); ok {
+		return code + canonical(inner)
+	}
+
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// baseCode returns builtin type code by encoding and size of base data type.
+func baseCode(dt *client.DataType) string {
+	sizes := map[string]map[uint64]string{
+		client.EncodingSigned:   {1: "a", 2: "s", 4: "i", 8: "x", 16: "n"},
+		client.EncodingUnsigned: {1: "h", 2: "t", 4: "j", 8: "y", 16: "o"},
+		client.EncodingChar:     {1: "c", 2: "Ds", 4: "Di"},
+		client.EncodingFloat:    {4: "f", 8: "d", 10: "e", 16: "e"},
+		client.EncodingBool:     {1: "b"},
+	}
+
+	return sizes[dt.Encoding][dt.Size]
+}
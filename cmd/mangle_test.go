@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"decompelf/src/decomp2dbg/client"
+	"strings"
+	"testing"
+)
+
+// expected names are g++ output, demangled by c++filt as in comments
+func TestMangle(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string // nil for globals
+		want string
+	}{
+		{"ns::f1", []string{"const char *"}, "_ZN2ns2f1EPKc"},                                  // ns::f1(char const*)
+		{"ns::f2", []string{"char * const"}, "_ZN2ns2f2EPc"},                                   // ns::f2(char*)
+		{"ns::f3", []string{"const char * const"}, "_ZN2ns2f3EPKc"},                            // ns::f3(char const*)
+		{"ns::f4", []string{"char const *", "const char*"}, "_ZN2ns2f4EPKcS1_"},                // ns::f4(char const*, char const*)
+		{"ns::f5", []string{"const int"}, "_ZN2ns2f5Ei"},                                       // ns::f5(int)
+		{"ns::f6", []string{"int[4]"}, "_ZN2ns2f6EPi"},                                         // ns::f6(int*)
+		{"ns::f7", []string{"const int[4]"}, "_ZN2ns2f7EPKi"},                                  // ns::f7(int const*)
+		{"ns::f8", []string{"ns::A *", "ns::A *"}, "_ZN2ns2f8EPNS_1AES1_"},                     // ns::f8(ns::A*, ns::A*)
+		{"ns::f9", []string{"const ns::A &"}, "_ZN2ns2f9ERKNS_1AE"},                            // ns::f9(ns::A const&)
+		{"ns::f10", []string{"char **"}, "_ZN2ns3f10EPPc"},                                     // ns::f10(char**)
+		{"ns::f11", []string{"const char **"}, "_ZN2ns3f11EPPKc"},                              // ns::f11(char const**)
+		{"ns::f12", []string{"char * const *"}, "_ZN2ns3f12EPKPc"},                             // ns::f12(char* const*)
+		{"ns::f13", []string{"undefined4", "uint"}, "_ZN2ns3f13Ejj"},                           // ns::f13(unsigned int, unsigned int)
+		{"ns::f14", []string{}, "_ZN2ns3f14Ev"},                                                // ns::f14()
+		{"ns::f15", []string{"const char *", "char *", "const char *"}, "_ZN2ns3f15EPKcPcS1_"}, // ns::f15(char const*, char*, char const*)
+		{"ns::A::A", []string{"ns::A *", "int"}, "_ZN2ns1AC1Ei"},                               // ns::A::A(int)
+		{"ns::A::~A", []string{"ns::A *"}, "_ZN2ns1AD1Ev"},                                     // ns::A::~A()
+		{"ns::g", nil, "_ZN2ns1gE"},                                                            // ns::g
+		{"f", []string{"int"}, "f"},
+		{"ns::operator+", []string{"int"}, "ns::operator+"},
+	}
+
+	for _, tt := range tests {
+		var args []*client.Variable
+		if tt.args != nil {
+			args = []*client.Variable{}
+		}
+
+		for i, typ := range tt.args {
+			name := "a"
+			// constructor and destructor arguments start with implicit object parameter
+			if i == 0 && strings.HasPrefix(tt.name, "ns::A::") {
+				name = "this"
+			}
+			args = append(args, &client.Variable{Name: name, Type: typ})
+		}
+
+		if got, _ := mangle(tt.name, args, nil); got != tt.want {
+			t.Errorf("%s%q: got %s, want %s", tt.name, tt.args, got, tt.want)
+		}
+	}
+}
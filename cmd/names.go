@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	NamesRaw   = "raw"
+	NamesDedup = "dedup"
+	NamesGDB   = "gdb"
+)
+
+type rename struct {
+	address uint64
+	from    string
+	to      string
+}
+
+// namer applies naming policy to symbol names: raw keeps names as is, dedup adds address suffix to names
+// already used at another address, gdb additionally replaces characters which need quoting in gdb expressions.
+type namer struct {
+	mode    string
+	used    map[string]uint64
+	renames []rename
+}
+
+func newNamer(mode string) *namer {
+	return &namer{mode: mode, used: map[string]uint64{}}
+}
+
+// name returns symbol name for decompiler name at decompiler address.
+func (n *namer) name(name string, address uint64) string {
+	if n.mode == NamesRaw {
+		return name
+	}
+
+	result := name
+	if n.mode == NamesGDB {
+		result = gdbSafe(name)
+	}
+
+	if used, ok := n.used[result]; ok && used != address {
+		base := fmt.Sprintf("%s_%x", result, address)
+		result = base
+		for i := 1; ; i++ {
+			if used, ok = n.used[result]; !ok || used == address {
+				break
+			}
+			result = fmt.Sprintf("%s_%d", base, i)
+		}
+	}
+
+	n.used[result] = address
+	if result != name {
+		slog.Debug("renamed symbol", "from", name, "to", result, "address", fmt.Sprintf("0x%x", address))
+		n.renames = append(n.renames, rename{address: address, from: name, to: result})
+	}
+
+	return result
+}
+
+// gdbSafe returns identifier usable in gdb expressions without quoting, ex. ns::f<int> becomes ns__f_int_.
+func gdbSafe(name string) string {
+	name = strings.ReplaceAll(name, "::", "__")
+
+	b := []byte(name)
+	for i, c := range b {
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			b[i] = '_'
+		}
+	}
+
+	if len(b) == 0 || b[0] >= '0' && b[0] <= '9' {
+		b = append([]byte{'_'}, b...)
+	}
+
+	return string(b)
+}
+
+// writeReport writes renames as tab separated address, decompiler name and symbol name.
+func (n *namer) writeReport(path string) error {
+	buf := &bytes.Buffer{}
+	for _, r := range n.renames {
+		fmt.Fprintf(buf, "0x%x\t%s\t%s\n", r.address, r.from, r.to)
+	}
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write rename report: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"decompelf/src/decomp2dbg/client"
+	"decompelf/src/loadbias"
+	"decompelf/src/tinyelf"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ntProvenance is type of "decompelf" note describing decompiler session.
+const ntProvenance = 1
+
+var (
+	ErrNoBuildID = errors.New("file has no build-id")
+	ErrBuildID   = errors.New("build-id must be even number of hex digits")
+)
+
+var buildIDRe = regexp.MustCompile(`^([0-9a-fA-F]{2})+$`)
+
+// addNotes adds build-id, debug link and provenance notes requested by cfg.
+func addNotes(cfg Config, t *tinyelf.TinyELF, elfInfo *client.ElfInfo) error {
+	switch {
+	case cfg.BuildID == "":
+	case cfg.BuildID == "auto":
+		t.SetBuildID(nil)
+	case strings.HasPrefix(cfg.BuildID, "hex:"):
+		value := strings.TrimPrefix(cfg.BuildID, "hex:")
+		if !buildIDRe.MatchString(value) {
+			return fmt.Errorf("%w: %s", ErrBuildID, value)
+		}
+
+		id, _ := hex.DecodeString(value)
+		t.SetBuildID(id)
+	default:
+		path := strings.TrimPrefix(cfg.BuildID, "file:")
+		id, err := loadbias.BuildID(path)
+		if err != nil {
+			return fmt.Errorf("failed to read build-id: %w", err)
+		}
+
+		if id == "" {
+			return fmt.Errorf("%w: %s", ErrNoBuildID, path)
+		}
+
+		decoded, _ := hex.DecodeString(id)
+		t.SetBuildID(decoded)
+	}
+
+	if cfg.DebugLink != "" {
+		data, err := os.ReadFile(cfg.DebugLink)
+		if err != nil {
+			return fmt.Errorf("failed to read debuglink file: %w", err)
+		}
+
+		t.SetDebugLink(filepath.Base(cfg.DebugLink), crc32.ChecksumIEEE(data))
+	}
+
+	if cfg.Provenance {
+		t.AddNote(".note.decompelf", "decompelf", ntProvenance, []byte(provenance(cfg, elfInfo)))
+	}
+
+	return nil
+}
+
+// provenance returns key=value lines describing decompiler session.
+func provenance(cfg Config, elfInfo *client.ElfInfo) string {
+	lines := []string{
+		"program=" + elfInfo.Name,
+		fmt.Sprintf("image_base=0x%x", elfInfo.ImageBase),
+		"url=" + cfg.URL,
+	}
+
+	if !cfg.Time.IsZero() {
+		lines = append(lines, "time="+cfg.Time.UTC().Format(time.RFC3339))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
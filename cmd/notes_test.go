@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"debug/elf"
+	"decompelf/src/decomp2dbg/client"
+	"decompelf/src/tinyelf"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildID returns build-id note descriptor of ELF file at path.
+func buildID(t *testing.T, path string) []byte {
+	s := open(t, path).Section(".note.gnu.build-id")
+	if s == nil {
+		t.Fatalf("%s: no build-id note", path)
+	}
+
+	data, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// namesz, descsz, type and "GNU\0", descriptor is padded
+	descsz := binary.LittleEndian.Uint32(data[4:])
+
+	return data[16 : 16+descsz]
+}
+
+func TestBuildIDForms(t *testing.T) {
+	// binary named like a hex value
+	dir := t.TempDir()
+	binPath := filepath.Join(dir, "cafe")
+	b := tinyelf.New64(binPath, elf.EM_X86_64, 0, binary.LittleEndian, uint(elf.ET_EXEC))
+	b.SetBuildID([]byte{1, 2, 3, 4})
+	if err := b.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newServer(t)
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	tests := map[string][]byte{
+		"cafe":           {1, 2, 3, 4},
+		"file:cafe":      {1, 2, 3, 4},
+		"hex:cafe":       {0xca, 0xfe},
+		"hex:DEADBEEF00": {0xde, 0xad, 0xbe, 0xef, 0},
+	}
+
+	for value, want := range tests {
+		cfg := testConfig(t)
+		cfg.BuildID = value
+		if err := Run(context.Background(), cfg, s.Client()); err != nil {
+			t.Fatalf("%s: %v", value, err)
+		}
+
+		if got := buildID(t, cfg.Out); !bytes.Equal(got, want) {
+			t.Errorf("%s: got %x, want %x", value, got, want)
+		}
+	}
+
+	for _, bad := range []string{"hex:abc", "hex:zz", "hex:"} {
+		cfg := testConfig(t)
+		cfg.BuildID = bad
+		if err := Run(context.Background(), cfg, s.Client()); !errors.Is(err, ErrBuildID) {
+			t.Errorf("%s: got %v, want %v", bad, err, ErrBuildID)
+		}
+	}
+
+	cfg := testConfig(t)
+	cfg.BuildID = "deadbeef"
+	if err := Run(context.Background(), cfg, s.Client()); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing file: got %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	info := &client.ElfInfo{Name: "fw", ImageBase: 0x10000}
+	cfg := Config{URL: "http://localhost:3662/RPC2", Time: time.Unix(1700000000, 0)}
+
+	want := "program=fw\nimage_base=0x10000\nurl=http://localhost:3662/RPC2\ntime=2023-11-14T22:13:20Z\n"
+	if got := provenance(cfg, info); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// replayed session without time of recording
+	cfg.Time = time.Time{}
+	if got := provenance(cfg, info); strings.Contains(got, "time=") {
+		t.Errorf("got %q, want no time", got)
+	}
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"decompelf/src/decomp2dbg/client"
+	"decompelf/src/loadbias"
+	"decompelf/src/rsp"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrLoadBaseAndSlide = errors.New("-load-base, -slide, -pid, -core and -rsp are mutually exclusive")
+	ErrPrologueMismatch = errors.New("function bytes do not match")
+)
+
+// loadSlide returns difference between runtime and decompiler addresses, negative slides wrap around.
+func loadSlide(ctx context.Context, cfg Config, elfInfo *client.ElfInfo, functions []*client.FunctionHeader) (uint64, error) {
+	imageBase := elfInfo.ImageBase
+
+	set := 0
+	for _, ok := range []bool{cfg.LoadBase != "", cfg.Slide != "", cfg.PID != 0, cfg.Core != "", cfg.RSP != ""} {
+		if ok {
+			set++
+		}
+	}
+
+	if set > 1 {
+		return 0, ErrLoadBaseAndSlide
+	}
+
+	if cfg.RSP != "" {
+		return rspSlide(ctx, cfg, imageBase, functions)
+	}
+
+	if cfg.PID != 0 || cfg.Core != "" {
+		var mappings []loadbias.Mapping
+		var err error
+		source := cfg.Core
+		if cfg.PID != 0 {
+			source = fmt.Sprintf("pid %d", cfg.PID)
+			mappings, err = loadbias.ProcessMappings(cfg.PID)
+		} else {
+			mappings, err = loadbias.CoreMappings(cfg.Core)
+		}
+
+		if err != nil {
+			return 0, fmt.Errorf("failed to read mappings of %s: %w", source, err)
+		}
+
+		base, err := loadbias.Find(mappings, elfInfo.Name)
+		if err != nil {
+			return 0, fmt.Errorf("failed to find load base in %s: %w", source, err)
+		}
+
+		slog.Info("found load base", "source", source, "name", elfInfo.Name, "load_base", fmt.Sprintf("0x%x", base))
+
+		return base - imageBase, nil
+	}
+
+	if cfg.LoadBase != "" {
+		base, err := strconv.ParseUint(cfg.LoadBase, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid load base %s: %w", cfg.LoadBase, err)
+		}
+
+		return base - imageBase, nil
+	}
+
+	if cfg.Slide != "" {
+		slide, err := strconv.ParseInt(cfg.Slide, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid slide %s: %w", cfg.Slide, err)
+		}
+
+		return uint64(slide), nil
+	}
+
+	return 0, nil
+}
+
+// rspSlide reads qOffsets from gdb stub and checks function bytes if cfg.RSPCheck is set.
+func rspSlide(ctx context.Context, cfg Config, imageBase uint64, functions []*client.FunctionHeader) (uint64, error) {
+	c, err := rsp.Dial(ctx, cfg.RSP, 10*time.Second)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to gdb stub %s: %w", cfg.RSP, err)
+	}
+	defer c.Close()
+
+	offsets, err := c.Offsets()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get offsets from gdb stub: %w", err)
+	}
+
+	slide := offsets.Text
+	if offsets.Segments {
+		slide = offsets.Text - imageBase
+	}
+
+	if offsets.Data != offsets.Text || offsets.Bss != offsets.Text {
+		slog.Warn("gdb stub reports different data offsets, using text offset for everything",
+			"text", fmt.Sprintf("0x%x", offsets.Text), "data", fmt.Sprintf("0x%x", offsets.Data), "bss", fmt.Sprintf("0x%x", offsets.Bss))
+	}
+
+	slog.Info("gdb stub offsets", "stub", cfg.RSP, "slide", fmt.Sprintf("0x%x", slide), "segments", offsets.Segments)
+
+	if cfg.RSPCheck == "" {
+		return slide, nil
+	}
+
+	name, want, err := parseCheck(cfg.RSPCheck)
+	if err != nil {
+		return 0, err
+	}
+
+	var f *client.FunctionHeader
+	for _, fh := range functions {
+		if fh.Name == name {
+			f = fh
+			break
+		}
+	}
+
+	if f == nil {
+		return 0, fmt.Errorf("function %s from -rsp-check not found", name)
+	}
+
+	got, err := c.ReadMemory(f.Value+slide, len(want))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read %s from gdb stub: %w", name, err)
+	}
+
+	if !bytes.Equal(got, want) {
+		return 0, fmt.Errorf("%w: %s at 0x%x: expected %x, got %x", ErrPrologueMismatch, name, f.Value+slide, want, got)
+	}
+
+	slog.Info("function bytes match", "name", name, "address", fmt.Sprintf("0x%x", f.Value+slide))
+
+	return slide, nil
+}
+
+// parseCheck parses name:hexbytes.
+func parseCheck(check string) (string, []byte, error) {
+	name, h, ok := strings.Cut(check, ":")
+	if !ok || name == "" {
+		return "", nil, fmt.Errorf("invalid -rsp-check %s, expected name:hexbytes", check)
+	}
+
+	want, err := hex.DecodeString(strings.TrimPrefix(h, "0x"))
+	if err != nil || len(want) == 0 {
+		return "", nil, fmt.Errorf("invalid -rsp-check bytes %s", h)
+	}
+
+	return name, want, nil
+}
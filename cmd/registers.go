@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"debug/elf"
+	"fmt"
+	"strings"
+)
+
+// DWARF register numbers by lowercase register name, per psABI of each machine.
+var dwarfRegisters = map[elf.Machine]map[string]uint64{
+	elf.EM_386:     regs386(),
+	elf.EM_X86_64:  regsX8664(),
+	elf.EM_ARM:     regsARM(),
+	elf.EM_AARCH64: regsAArch64(),
+	elf.EM_MIPS:    regsMIPS(),
+	elf.EM_RISCV:   regsRISCV(),
+	elf.EM_PPC:     regsPPC(),
+	elf.EM_PPC64:   regsPPC(),
+}
+
+// Decompiler stack offsets are relative to stack pointer at function entry.
+// CFA is the stack pointer before call instruction, on x86 it is above pushed return address,
+// machines returning through link register push nothing and their CFA is the entry stack pointer, offset 0.
+var stackReturnAddressSize = map[elf.Machine]int64{
+	elf.EM_386:    4,
+	elf.EM_X86_64: 8,
+}
+
+// stackPointers are names of stack pointer register in dwarfRegisters.
+var stackPointers = map[elf.Machine]string{
+	elf.EM_386:     "esp",
+	elf.EM_X86_64:  "rsp",
+	elf.EM_ARM:     "sp",
+	elf.EM_AARCH64: "sp",
+	elf.EM_MIPS:    "sp",
+	elf.EM_RISCV:   "sp",
+	elf.EM_PPC:     "sp",
+	elf.EM_PPC64:   "sp",
+}
+
+// DWARFRegister returns DWARF number of register name reported by decompiler.
+func DWARFRegister(machine elf.Machine, name string) (uint64, bool) {
+	regs, ok := dwarfRegisters[machine]
+	if !ok {
+		return 0, false
+	}
+
+	n, ok := regs[strings.ToLower(name)]
+
+	return n, ok
+}
+
+func numbered(m map[string]uint64, prefix string, count int, base uint64) {
+	for i := 0; i < count; i++ {
+		m[fmt.Sprintf("%s%d", prefix, i)] = base + uint64(i)
+	}
+}
+
+func named(m map[string]uint64, base uint64, names ...string) {
+	for i, n := range names {
+		if n != "" {
+			m[n] = base + uint64(i)
+		}
+	}
+}
+
+func regs386() map[string]uint64 {
+	m := map[string]uint64{}
+	named(m, 0, "eax", "ecx", "edx", "ebx", "esp", "ebp", "esi", "edi", "eip")
+	named(m, 0, "ax", "cx", "dx", "bx", "sp", "bp", "si", "di")
+	named(m, 0, "al", "cl", "dl", "bl")
+	numbered(m, "st", 8, 11)
+	numbered(m, "xmm", 8, 21)
+
+	return m
+}
+
+func regsX8664() map[string]uint64 {
+	m := map[string]uint64{}
+	named(m, 0, "rax", "rdx", "rcx", "rbx", "rsi", "rdi", "rbp", "rsp")
+	named(m, 0, "eax", "edx", "ecx", "ebx", "esi", "edi", "ebp", "esp")
+	named(m, 0, "ax", "dx", "cx", "bx", "si", "di", "bp", "sp")
+	named(m, 0, "al", "dl", "cl", "bl", "sil", "dil", "bpl", "spl")
+	for i := 8; i < 16; i++ {
+		for _, suffix := range []string{"", "d", "w", "b"} {
+			m[fmt.Sprintf("r%d%s", i, suffix)] = uint64(i)
+		}
+	}
+	m["rip"] = 16
+	numbered(m, "xmm", 16, 17)
+	numbered(m, "st", 8, 33)
+
+	return m
+}
+
+func regsARM() map[string]uint64 {
+	m := map[string]uint64{}
+	numbered(m, "r", 16, 0)
+	named(m, 11, "fp", "ip", "sp", "lr", "pc")
+	numbered(m, "s", 32, 64)
+	numbered(m, "d", 32, 256)
+
+	return m
+}
+
+func regsAArch64() map[string]uint64 {
+	m := map[string]uint64{}
+	numbered(m, "x", 31, 0)
+	numbered(m, "w", 31, 0)
+	named(m, 29, "fp", "lr", "sp")
+	m["wsp"] = 31
+	for _, p := range []string{"v", "q", "d", "s", "h", "b"} {
+		numbered(m, p, 32, 64)
+	}
+
+	return m
+}
+
+func regsMIPS() map[string]uint64 {
+	m := map[string]uint64{}
+	numbered(m, "r", 32, 0)
+	numbered(m, "$", 32, 0)
+	named(m, 0, "zero", "at", "v0", "v1", "a0", "a1", "a2", "a3",
+		"t0", "t1", "t2", "t3", "t4", "t5", "t6", "t7",
+		"s0", "s1", "s2", "s3", "s4", "s5", "s6", "s7",
+		"t8", "t9", "k0", "k1", "gp", "sp", "s8", "ra")
+	m["fp"] = 30
+	numbered(m, "f", 32, 32)
+
+	return m
+}
+
+func regsRISCV() map[string]uint64 {
+	m := map[string]uint64{}
+	numbered(m, "x", 32, 0)
+	named(m, 0, "zero", "ra", "sp", "gp", "tp", "t0", "t1", "t2",
+		"s0", "s1", "a0", "a1", "a2", "a3", "a4", "a5",
+		"a6", "a7", "s2", "s3", "s4", "s5", "s6", "s7",
+		"s8", "s9", "s10", "s11", "t3", "t4", "t5", "t6")
+	m["fp"] = 8
+	numbered(m, "f", 32, 32)
+	named(m, 32, "ft0", "ft1", "ft2", "ft3", "ft4", "ft5", "ft6", "ft7",
+		"fs0", "fs1", "fa0", "fa1", "fa2", "fa3", "fa4", "fa5",
+		"fa6", "fa7", "fs2", "fs3", "fs4", "fs5", "fs6", "fs7",
+		"fs8", "fs9", "fs10", "fs11", "ft8", "ft9", "ft10", "ft11")
+
+	return m
+}
+
+func regsPPC() map[string]uint64 {
+	m := map[string]uint64{}
+	numbered(m, "r", 32, 0)
+	numbered(m, "f", 32, 32)
+	m["sp"] = 1
+	m["lr"] = 65
+	m["ctr"] = 66
+
+	return m
+}
@@ -0,0 +1,374 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"debug/dwarf"
+	"debug/elf"
+	"decompelf/src/decomp2dbg/client"
+	"decompelf/src/decomp2dbg/fakeserver"
+	"decompelf/src/rsp/fakestub"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newServer(t *testing.T) *fakeserver.Server {
+	p, err := fakeserver.LoadFixture("testdata/program.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := fakeserver.New(p)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func testConfig(t *testing.T) Config {
+	return Config{
+		Out:       filepath.Join(t.TempDir(), "tinyelf"),
+		ElfType:   int(elf.ET_REL),
+		DWARF:     true,
+		Types:     true,
+		AutoLocal: true,
+		Time:      time.Unix(1700000000, 0),
+	}
+}
+
+// run generates symbol file for fixture program and opens it.
+func run(t *testing.T, cfg Config) *elf.File {
+	if err := Run(context.Background(), cfg, newServer(t).Client()); err != nil {
+		t.Fatal(err)
+	}
+
+	return open(t, cfg.Out)
+}
+
+func open(t *testing.T, path string) *elf.File {
+	f, err := elf.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	return f
+}
+
+func symbols(t *testing.T, f *elf.File) map[string]elf.Symbol {
+	list, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// values of ET_REL symbols are relative to their sections
+	result := map[string]elf.Symbol{}
+	for _, s := range list {
+		if f.Type == elf.ET_REL && int(s.Section) < len(f.Sections) {
+			s.Value += f.Sections[s.Section].Addr
+		}
+		result[s.Name] = s
+	}
+
+	return result
+}
+
+func TestRunSymbols(t *testing.T) {
+	f := run(t, testConfig(t))
+	if f.Class != elf.ELFCLASS64 || f.Machine != elf.EM_X86_64 || f.Type != elf.ET_REL {
+		t.Errorf("got %s %s %s", f.Class, f.Machine, f.Type)
+	}
+
+	syms := symbols(t, f)
+	tests := []struct {
+		name    string
+		value   uint64
+		size    uint64
+		typ     elf.SymType
+		bind    elf.SymBind
+		section string
+	}{
+		{"main", 0x101000, 0x20, elf.STT_FUNC, elf.STB_GLOBAL, ".text"},
+		// size inferred up to the next function, decompiler generated name is local
+		{"FUN_00101020", 0x101020, 0x10, elf.STT_FUNC, elf.STB_LOCAL, ".text"},
+		{"ns::A::get", 0x101030, 0x10, elf.STT_FUNC, elf.STB_GLOBAL, ".text"},
+		{"helper", 0x101040, 8, elf.STT_FUNC, elf.STB_GLOBAL, ".text"},
+		{"helper_101048", 0x101048, 8, elf.STT_FUNC, elf.STB_GLOBAL, ".text"},
+		{"counter", 0x104000, 8, elf.STT_OBJECT, elf.STB_GLOBAL, ".bss"},
+		{"pair", 0x104010, 8, elf.STT_OBJECT, elf.STB_GLOBAL, ".bss"},
+		// not a field of existing global, size inferred up to the end of .bss
+		{"buf.1", 0x104020, 0xfe0, elf.STT_OBJECT, elf.STB_GLOBAL, ".bss"},
+	}
+
+	for _, tt := range tests {
+		s, ok := syms[tt.name]
+		if !ok {
+			t.Errorf("%s: missing", tt.name)
+			continue
+		}
+
+		section := ""
+		if int(s.Section) < len(f.Sections) {
+			section = f.Sections[s.Section].Name
+		}
+
+		if s.Value != tt.value || s.Size != tt.size || elf.ST_TYPE(s.Info) != tt.typ || elf.ST_BIND(s.Info) != tt.bind || section != tt.section {
+			t.Errorf("%s: got 0x%x size 0x%x %s %s %s, want 0x%x size 0x%x %s %s %s", tt.name,
+				s.Value, s.Size, elf.ST_TYPE(s.Info), elf.ST_BIND(s.Info), section,
+				tt.value, tt.size, tt.typ, tt.bind, tt.section)
+		}
+	}
+
+	if _, ok := syms["pair.second"]; ok {
+		t.Errorf("field pair.second is not collapsed")
+	}
+}
+
+func TestRunDWARF(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Vars = true
+	d, err := run(t, cfg).DWARF()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// globals and functions by name, variables of functions by function name
+	found := map[string]*dwarf.Entry{}
+	children := map[string][]string{}
+	r := d.Reader()
+	function := ""
+	for {
+		e, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if e == nil {
+			break
+		}
+
+		name, _ := e.Val(dwarf.AttrName).(string)
+		switch {
+		case e.Tag == 0:
+			function = ""
+		case e.Tag == dwarf.TagSubprogram:
+			found[name] = e
+			if e.Children {
+				function = name
+			}
+		case function != "":
+			children[function] = append(children[function], name)
+		case e.Tag == dwarf.TagVariable:
+			found[name] = e
+		}
+	}
+
+	main := found["main"]
+	if main == nil {
+		t.Fatal("no main subprogram")
+	}
+
+	if low, _ := main.Val(dwarf.AttrLowpc).(uint64); low != 0x101000 {
+		t.Errorf("main low pc: got 0x%x", low)
+	}
+
+	// fixture memory map has no call frame information
+	if fb, _ := main.Val(dwarf.AttrFrameBase).([]byte); !bytes.Equal(fb, []byte{0x77, 0}) {
+		t.Errorf("main frame base: got %x, want DW_OP_breg7 0", fb)
+	}
+
+	if got := children["main"]; len(got) != 2 || got[0] != "argc" || got[1] != "local_c" {
+		t.Errorf("main variables: got %v", got)
+	}
+
+	counter := found["counter"]
+	if counter == nil {
+		t.Fatal("no counter variable")
+	}
+
+	typ, err := d.Type(counter.Val(dwarf.AttrType).(dwarf.Offset))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st, ok := typ.(*dwarf.StructType)
+	if !ok || st.StructName != "counter_t" || st.ByteSize != 8 || len(st.Field) != 2 || st.Field[1].Name != "last" || st.Field[1].ByteOffset != 4 {
+		t.Errorf("counter type: got %s", typ)
+	}
+}
+
+func TestRunSource(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.SourceDir = t.TempDir()
+	d, err := run(t, cfg).DWARF()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := filepath.Join(cfg.SourceDir, "prog.c")
+	if _, err = os.Stat(src); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := map[uint64]int{}
+	r := d.Reader()
+	for {
+		cu, err := r.Next()
+		if err != nil || cu == nil {
+			break
+		}
+
+		lr, err := d.LineReader(cu)
+		if err != nil || lr == nil {
+			r.SkipChildren()
+			continue
+		}
+
+		e := dwarf.LineEntry{}
+		for lr.Next(&e) == nil {
+			if e.File != nil && e.File.Name == src && !e.EndSequence {
+				lines[e.Address] = e.Line
+			}
+		}
+		r.SkipChildren()
+	}
+
+	// the first decompiled line is the first line of file
+	if lines[0x101000] != 1 || lines[0x101008] != 3 || lines[0x101018] != 4 {
+		t.Errorf("line table: got %v", lines)
+	}
+}
+
+func TestRunNames(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Names = NamesGDB
+	cfg.Mangle = true
+	cfg.Vars = true
+	syms := symbols(t, run(t, cfg))
+
+	for _, name := range []string{"_ZN2ns1A3getEPKc", "helper", "helper_101048", "buf_1"} {
+		if _, ok := syms[name]; !ok {
+			t.Errorf("%s: missing", name)
+		}
+	}
+}
+
+func TestRunSlide(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.ElfType = int(elf.ET_EXEC)
+	cfg.Slide = "0x1000"
+	syms := symbols(t, run(t, cfg))
+
+	if s := syms["main"]; s.Value != 0x102000 {
+		t.Errorf("main: got 0x%x, want 0x102000", s.Value)
+	}
+}
+
+func TestRunRSP(t *testing.T) {
+	stub, err := fakestub.New("TextSeg=201000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stub.Close()
+	stub.SetMemory(0x202000, []byte{0x55, 0x48, 0x89, 0xe5})
+
+	cfg := testConfig(t)
+	cfg.ElfType = int(elf.ET_EXEC)
+	cfg.RSP = stub.Addr()
+	cfg.RSPCheck = "main:554889e5"
+	if s := symbols(t, run(t, cfg))["main"]; s.Value != 0x202000 {
+		t.Errorf("main: got 0x%x, want 0x202000", s.Value)
+	}
+
+	cfg.RSPCheck = "main:c3"
+	if err = Run(context.Background(), cfg, newServer(t).Client()); !errors.Is(err, ErrPrologueMismatch) {
+		t.Errorf("got %v, want %v", err, ErrPrologueMismatch)
+	}
+}
+
+func TestRunReproducible(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.BuildID = "auto"
+	cfg.Provenance = true
+	s := newServer(t)
+
+	// compile unit is named after output file
+	other := cfg
+	other.Out = filepath.Join(t.TempDir(), filepath.Base(cfg.Out))
+	for _, c := range []Config{cfg, other} {
+		if err := Run(context.Background(), c, s.Client()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	a, _ := os.ReadFile(cfg.Out)
+	b, _ := os.ReadFile(other.Out)
+	if !bytes.Equal(a, b) {
+		t.Errorf("outputs of the same session differ")
+	}
+
+	note := open(t, cfg.Out).Section(".note.gnu.build-id")
+	if note == nil || note.Size != 16+20 {
+		t.Errorf("build-id note: got %+v", note)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Sizes = "guess"
+	if err := Run(context.Background(), cfg, newServer(t).Client()); !errors.Is(err, ErrSizes) {
+		t.Errorf("got %v, want %v", err, ErrSizes)
+	}
+
+	s := newServer(t)
+	s.InjectFault("d2d.global_vars", 7, "no program")
+	var fault *client.FaultError
+	if err := Run(context.Background(), testConfig(t), s.Client()); !errors.As(err, &fault) || fault.Code != 7 {
+		t.Errorf("got %v, want fault 7", err)
+	}
+
+	s = newServer(t)
+	s.Handle("d2d.ping", func([]any) (any, error) { return false, nil })
+	if err := Run(context.Background(), testConfig(t), s.Client()); !errors.Is(err, ErrPing) {
+		t.Errorf("got %v, want %v", err, ErrPing)
+	}
+}
+
+func TestDelta(t *testing.T) {
+	s := newServer(t)
+	cfg := testConfig(t)
+	state := cfg.Out + ".json"
+	script := cfg.Out + ".gdb"
+	ctx := context.Background()
+
+	if err := Delta(ctx, cfg, s.Client(), state, script); !errors.Is(err, ErrNoState) {
+		t.Fatalf("got %v, want %v", err, ErrNoState)
+	}
+
+	if err := RunWithState(ctx, cfg, s.Client(), state); err != nil {
+		t.Fatal(err)
+	}
+
+	s.Program().Functions[0].Name = "entry"
+	if err := Delta(ctx, cfg, s.Client(), state, script); err != nil {
+		t.Fatal(err)
+	}
+
+	first := cfg.Out + ".delta1"
+	if syms := symbols(t, open(t, first)); len(syms) != 1 || syms["entry"].Value != 0x101000 || syms["entry"].Size != 0x20 {
+		t.Errorf("delta1: got %v", syms)
+	}
+
+	s.Program().Functions[0].Name = "start"
+	if err := Delta(ctx, cfg, s.Client(), state, script); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := os.ReadFile(script)
+	want := "remove-symbol-file " + first + "\nadd-symbol-file " + cfg.Out + ".delta2\n"
+	if string(got) != want {
+		t.Errorf("gdb commands: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"debug/elf"
+	"decompelf/src/decomp2dbg/client"
+	"decompelf/src/tinyelf"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// addMemoryBlocks adds a section per decompiler memory block and returns number of added sections,
+// default sections are used with servers and recordings without memory map.
+func addMemoryBlocks(ctx context.Context, d client.D2D, t *tinyelf.TinyELF, slide uint64) (int, error) {
+	blocks, err := d.MemoryMap(ctx)
+	if err != nil {
+		if !unsupported(err) {
+			return 0, fmt.Errorf("failed to get memory map: %w", err)
+		}
+
+		slog.Warn("decomp2dbg server does not provide memory map, using default sections", "error", err.Error())
+
+		return 0, nil
+	}
+
+	slog.Info("memory blocks", "total", len(blocks))
+
+	added := 0
+	for _, b := range blocks {
+		if b.Size == 0 {
+			continue
+		}
+		added++
+
+		flags := elf.SHF_ALLOC
+		if b.Write {
+			flags |= elf.SHF_WRITE
+		}
+		if b.Execute {
+			flags |= elf.SHF_EXECINSTR
+		}
+
+		t.AddSection(&tinyelf.Section{Name: b.Name, Type: elf.SHT_NOBITS, Flags: flags, Addr: b.Start + slide, Size: b.Size, Addralign: 1})
+	}
+
+	return added, nil
+}
+
+// unsupported reports whether err is a fault of optional call or a call missing from recorded session.
+func unsupported(err error) bool {
+	var fault *client.FaultError
+
+	return errors.As(err, &fault) || errors.Is(err, client.ErrNotRecorded)
+}
@@ -0,0 +1,242 @@
+package cmd
+
+import (
+	"context"
+	"debug/elf"
+	"decompelf/src/decomp2dbg/client"
+	"decompelf/src/loadbias"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrProgram = errors.New("-program must be <build-id or binary>=<decomp2dbg url or recorded session>")
+
+// servedProgram is decompiler session of program with build-id.
+type servedProgram struct {
+	buildID string
+	// source is decomp2dbg server url or directory recorded with -record
+	source string
+	// binary is original program, generated file gets its ELF type and addresses if set
+	binary string
+}
+
+func parseProgram(v string) (*servedProgram, error) {
+	key, source, ok := strings.Cut(v, "=")
+	if !ok || key == "" || source == "" {
+		return nil, fmt.Errorf("%w: %s", ErrProgram, v)
+	}
+
+	if buildIDRe.MatchString(key) {
+		return &servedProgram{buildID: strings.ToLower(key), source: source}, nil
+	}
+
+	id, err := loadbias.BuildID(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build-id: %w", err)
+	}
+
+	if id == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNoBuildID, key)
+	}
+
+	return &servedProgram{buildID: id, source: source, binary: key}, nil
+}
+
+// Serve runs debuginfod server, symbol files of configured programs are generated on the first request and cached.
+func Serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	cfg := Config{}
+	s := &debuginfod{programs: map[string]*servedProgram{}, locks: map[string]*sync.Mutex{}}
+	var listen string
+	fs.StringVar(&listen, "listen", ":8002", "address of debuginfod server")
+	fs.StringVar(&s.cache, "cache", defaultCache(), "directory of generated files")
+	fs.DurationVar(&s.ttl, "ttl", 0, "regenerate cached files older than ttl, 0 - never")
+	fs.BoolVar(&s.source, "source", false, "emit DWARF line table and serve decompiled source")
+	fs.Func("program", "<build-id or binary>=<decomp2dbg url or recorded session>, ex. ./fw.elf=http://localhost:3662/RPC2, repeatable", func(v string) error {
+		p, err := parseProgram(v)
+		if err != nil {
+			return err
+		}
+
+		s.programs[p.buildID] = p
+		return nil
+	})
+	s.client = clientFlags(fs)
+	outputFlags(fs, &cfg)
+	fs.Parse(args)
+	s.cfg = cfg
+	checkClientFlags(s.client)
+
+	if len(s.programs) == 0 {
+		slog.Error("no programs to serve, add -program")
+		os.Exit(2)
+	}
+
+	var err error
+	if s.cache, err = filepath.Abs(s.cache); err != nil {
+		fatal("invalid cache directory", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	server := &http.Server{Addr: listen, Handler: s}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+
+	for _, p := range s.programs {
+		slog.Info("serving", "build_id", p.buildID, "source", p.source, "binary", p.binary)
+	}
+	slog.Info("debuginfod listening", "address", listen, "cache", s.cache)
+
+	if err = server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		fatal("debuginfod server failed", err)
+	}
+}
+
+func defaultCache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "decompelf", "debuginfod")
+}
+
+// debuginfod implements /buildid/<id>/debuginfo and /buildid/<id>/source/<path> of debuginfod HTTP API.
+type debuginfod struct {
+	cfg      Config
+	client   *client.Client
+	programs map[string]*servedProgram
+	cache    string
+	ttl      time.Duration
+	source   bool
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func (s *debuginfod) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest, ok := strings.CutPrefix(r.URL.Path, "/buildid/")
+	id, kind, _ := strings.Cut(rest, "/")
+	p := s.programs[strings.ToLower(id)]
+	if !ok || p == nil || kind != "debuginfo" && (!s.source || !strings.HasPrefix(kind, "source/")) {
+		http.NotFound(w, r)
+		return
+	}
+
+	path, err := s.generate(r.Context(), p)
+	if err != nil {
+		slog.Error("failed to generate symbol file", "build_id", p.buildID, "error", err.Error())
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	if src, ok := strings.CutPrefix(kind, "source"); ok {
+		path = filepath.Clean(src)
+		if !strings.HasPrefix(path, filepath.Join(s.cache, p.buildID, "source")+string(filepath.Separator)) {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	slog.Info("debuginfod request", "path", r.URL.Path, "file", path)
+	http.ServeFile(w, r, path)
+}
+
+// generate returns path of cached symbol file of p, generating it if needed.
+func (s *debuginfod) generate(ctx context.Context, p *servedProgram) (string, error) {
+	s.mu.Lock()
+	lock, ok := s.locks[p.buildID]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.locks[p.buildID] = lock
+	}
+	s.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	dir := filepath.Join(s.cache, p.buildID)
+	path := filepath.Join(dir, "debuginfo")
+	if info, err := os.Stat(path); err == nil && (s.ttl == 0 || time.Since(info.ModTime()) < s.ttl) {
+		return path, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	cfg := s.cfg
+	cfg.URL = p.source
+	cfg.Out = path + ".tmp"
+	cfg.BuildID = "hex:" + p.buildID
+	cfg.ElfType = int(elf.ET_EXEC)
+	if s.source {
+		cfg.SourceDir = filepath.Join(dir, "source")
+		if err := os.MkdirAll(cfg.SourceDir, 0755); err != nil {
+			return "", err
+		}
+	}
+
+	if p.binary != "" {
+		elfType, base, err := linkBase(p.binary)
+		if err != nil {
+			return "", err
+		}
+
+		cfg.ElfType = int(elfType)
+		cfg.LoadBase = fmt.Sprintf("0x%x", base)
+	}
+
+	c := *s.client
+	c.URL = p.source
+	c.HTTPClient = &http.Client{}
+
+	var replay *client.ReplayTransport
+	if info, err := os.Stat(p.source); err == nil && info.IsDir() {
+		if replay, err = client.NewReplayTransport(p.source); err != nil {
+			return "", fmt.Errorf("failed to load recorded session: %w", err)
+		}
+		c.HTTPClient.Transport = replay
+	}
+	cfg.Time = generationTime(replay)
+
+	slog.Info("generating symbol file", "build_id", p.buildID, "source", p.source)
+	if err := Run(ctx, cfg, &c); err != nil {
+		return "", err
+	}
+
+	return path, os.Rename(cfg.Out, path)
+}
+
+// linkBase returns ELF type of binary and address of its first loadable page, decompiler image base is moved there.
+func linkBase(path string) (elf.Type, uint64, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	low := uint64(0)
+	found := false
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD && (!found || p.Vaddr < low) {
+			low = p.Vaddr
+			found = true
+		}
+	}
+
+	return f.Type, low &^ 0xfff, nil
+}
@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"bytes"
+	"debug/elf"
+	"decompelf/src/decomp2dbg/fakeserver"
+	"decompelf/src/tinyelf"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const servedID = "0123456789abcdef"
+
+func newDebuginfod(t *testing.T, fs *fakeserver.Server) *debuginfod {
+	return &debuginfod{
+		cfg:      Config{DWARF: true, Types: true},
+		client:   fs.Client(),
+		programs: map[string]*servedProgram{servedID: {buildID: servedID, source: fs.URL + "/RPC2"}},
+		cache:    t.TempDir(),
+		source:   true,
+		locks:    map[string]*sync.Mutex{},
+	}
+}
+
+func get(s *debuginfod, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+	return w
+}
+
+func TestServeDebuginfo(t *testing.T) {
+	fs := newServer(t)
+	s := newDebuginfod(t, fs)
+
+	// build-id is case insensitive
+	for _, id := range []string{servedID, "0123456789ABCDEF"} {
+		w := get(s, "/buildid/"+id+"/debuginfo")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d", id, w.Code)
+		}
+
+		f, err := elf.NewFile(bytes.NewReader(w.Body.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if f.Type != elf.ET_EXEC || f.Section(".note.gnu.build-id") == nil {
+			t.Errorf("%s: got %s without build-id", id, f.Type)
+		}
+	}
+
+	// generated once, then served from cache
+	if calls := fs.Calls("d2d.function_headers"); calls != 1 {
+		t.Errorf("got %d generations, want 1", calls)
+	}
+
+	for _, target := range []string{
+		"/buildid/ffff/debuginfo",
+		"/buildid/" + servedID + "/executable",
+		"/buildid/" + servedID,
+		"/other/" + servedID + "/debuginfo",
+	} {
+		if w := get(s, target); w.Code != http.StatusNotFound {
+			t.Errorf("%s: got status %d, want 404", target, w.Code)
+		}
+	}
+}
+
+func TestServeTTL(t *testing.T) {
+	fs := newServer(t)
+	s := newDebuginfod(t, fs)
+	s.ttl = time.Hour
+
+	for i := 0; i < 2; i++ {
+		if w := get(s, "/buildid/"+servedID+"/debuginfo"); w.Code != http.StatusOK {
+			t.Fatalf("got status %d", w.Code)
+		}
+	}
+
+	if calls := fs.Calls("d2d.function_headers"); calls != 1 {
+		t.Errorf("fresh cache: got %d generations, want 1", calls)
+	}
+
+	// expired file is regenerated
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(s.cache, servedID, "debuginfo"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := get(s, "/buildid/"+servedID+"/debuginfo"); w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+
+	if calls := fs.Calls("d2d.function_headers"); calls != 2 {
+		t.Errorf("expired cache: got %d generations, want 2", calls)
+	}
+
+	if _, err := os.Stat(filepath.Join(s.cache, servedID, "debuginfo.tmp")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("temporary file is left: %v", err)
+	}
+}
+
+func TestServeGenerateError(t *testing.T) {
+	fs := newServer(t)
+	fs.InjectFault("d2d.global_vars", 1, "no program")
+	s := newDebuginfod(t, fs)
+
+	if w := get(s, "/buildid/"+servedID+"/debuginfo"); w.Code != http.StatusBadGateway {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusBadGateway)
+	}
+}
+
+func TestServeSource(t *testing.T) {
+	s := newDebuginfod(t, newServer(t))
+	src := filepath.Join(s.cache, servedID, "source", "prog.c")
+
+	w := get(s, "/buildid/"+servedID+"/source"+src)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+
+	want, _ := os.ReadFile(src)
+	if body, _ := io.ReadAll(w.Body); len(want) == 0 || !bytes.Equal(body, want) {
+		t.Errorf("got %q, want %q", body, want)
+	}
+
+	secret := filepath.Join(s.cache, "secret")
+	if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sourceDir := filepath.Join(s.cache, servedID, "source")
+	for _, target := range []string{
+		"/buildid/" + servedID + "/source" + sourceDir + "/../../secret",
+		"/buildid/" + servedID + "/source" + sourceDir + "/%2e%2e/%2e%2e/secret",
+		"/buildid/" + servedID + "/source" + sourceDir + "%2f..%2f..%2fsecret",
+		"/buildid/" + servedID + "/source" + sourceDir,
+		"/buildid/" + servedID + "/source/etc/passwd",
+		"/buildid/" + servedID + "/source" + filepath.Join(s.cache, servedID, "debuginfo"),
+	} {
+		if w := get(s, target); w.Code != http.StatusNotFound {
+			t.Errorf("%s: got status %d, want 404", target, w.Code)
+		}
+	}
+
+	s.source = false
+	if w := get(s, "/buildid/"+servedID+"/source"+src); w.Code != http.StatusNotFound {
+		t.Errorf("source disabled: got status %d, want 404", w.Code)
+	}
+}
+
+func TestParseProgram(t *testing.T) {
+	binPath := filepath.Join(t.TempDir(), "fw.elf")
+	b := tinyelf.New32(binPath, elf.EM_ARM, 0, binary.LittleEndian, uint(elf.ET_EXEC))
+	b.SetBuildID([]byte{0xab, 0xcd})
+	if err := b.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := parseProgram("ABCDEF=http://localhost:3662/RPC2")
+	if err != nil || p.buildID != "abcdef" || p.source != "http://localhost:3662/RPC2" || p.binary != "" {
+		t.Errorf("got %+v, %v", p, err)
+	}
+
+	p, err = parseProgram(binPath + "=/tmp/session")
+	if err != nil || p.buildID != "abcd" || p.source != "/tmp/session" || p.binary != binPath {
+		t.Errorf("got %+v, %v", p, err)
+	}
+
+	for _, bad := range []string{"", "abcd", "=url", "abcd="} {
+		if _, err = parseProgram(bad); !errors.Is(err, ErrProgram) {
+			t.Errorf("%q: got %v, want %v", bad, err, ErrProgram)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"decompelf/src/decomp2dbg/client"
+	"decompelf/src/tinyelf"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// decompileAll fetches decompilation of every function and joins it into a single source file at path.
+func decompileAll(ctx context.Context, d client.D2D, functions []*client.FunctionHeader, path string) (*tinyelf.Source, error) {
+	src := &tinyelf.Source{Path: path}
+	text := &bytes.Buffer{}
+	lines := 0
+
+	for _, f := range functions {
+		dec, err := d.Decompile(ctx, f.Value)
+		if err != nil {
+			var fault *client.FaultError
+			if errors.As(err, &fault) {
+				slog.Warn("failed to decompile function", "name", f.Name, "address", fmt.Sprintf("0x%x", f.Value), "error", err.Error())
+				continue
+			}
+
+			return nil, fmt.Errorf("failed to decompile %s: %w", f.Name, err)
+		}
+
+		if len(dec.Lines) == 0 {
+			continue
+		}
+
+		end := f.Value + f.Size
+		first := map[uint64]int{}
+		for addr, line := range dec.AddrLines {
+			if addr < f.Value || (f.Size != 0 && addr >= end) || line < 0 || line >= len(dec.Lines) {
+				continue
+			}
+
+			if l, ok := first[addr]; !ok || line < l {
+				first[addr] = line
+			}
+		}
+
+		if len(first) == 0 {
+			first[f.Value] = max(dec.CurrLine, 0)
+		}
+
+		seq := tinyelf.LineSequence{End: end}
+		for addr, line := range first {
+			seq.Rows = append(seq.Rows, tinyelf.LineRow{Address: addr, Line: lines + line + 1})
+			if f.Size == 0 && addr >= seq.End {
+				seq.End = addr + 1
+			}
+		}
+
+		sort.Slice(seq.Rows, func(i, j int) bool {
+			return seq.Rows[i].Address < seq.Rows[j].Address
+		})
+
+		src.Sequences = append(src.Sequences, seq)
+
+		for _, l := range dec.Lines {
+			text.WriteString(strings.TrimRight(l, "\r\n"))
+			text.WriteByte('\n')
+		}
+		text.WriteByte('\n')
+		lines += len(dec.Lines) + 1
+	}
+
+	src.Text = text.Bytes()
+
+	return src, nil
+}
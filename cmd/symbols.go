@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"debug/elf"
+	"regexp"
+)
+
+// autoNameRe matches names generated by Ghidra, ex. FUN_00101129, DAT_00104010, s_hello_00102004.
+var autoNameRe = regexp.MustCompile(`^(thunk_)?(FUN|LAB|SUB|DAT|PTR|EXT|UNK|OFF|BYTE|WORD|DWORD|QWORD|FLOAT|DOUBLE|switchD|caseD)_[0-9a-fA-F]+$|^[su]_.*_[0-9a-fA-F]{8,16}$`)
+
+// binding returns STB_LOCAL for names generated by decompiler if autoLocal is set, so they don't clash with real ones.
+func binding(name string, autoLocal bool) elf.SymBind {
+	if autoLocal && autoNameRe.MatchString(name) {
+		return elf.STB_LOCAL
+	}
+
+	return elf.STB_GLOBAL
+}
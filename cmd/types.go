@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"context"
+	"decompelf/src/decomp2dbg/client"
+	"decompelf/src/tinyelf"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// dataTypes returns type resolver with data types from decomp2dbg server if cfg.Types is set.
+func dataTypes(ctx context.Context, d client.D2D, cfg Config, is32 bool) (*typeResolver, error) {
+	ptrSize := uint64(8)
+	if is32 {
+		ptrSize = 4
+	}
+
+	r := newTypeResolver(nil, ptrSize)
+	if !cfg.Types {
+		return r, nil
+	}
+
+	known, err := d.DataTypes(ctx)
+	if err != nil {
+		if !unsupported(err) {
+			return nil, fmt.Errorf("failed to get data types: %w", err)
+		}
+
+		slog.Warn("decomp2dbg server does not provide data types", "error", err.Error())
+	}
+
+	slog.Info("data types", "total", len(known))
+	r.known = known
+
+	return r, nil
+}
+
+var arrayRe = regexp.MustCompile(`^(.*)\[(\d+)\]$`)
+
+// typeResolver converts decompiler data types to tinyelf types, sharing them between functions and globals.
+type typeResolver struct {
+	known    map[string]*client.DataType
+	resolved map[string]*tinyelf.Type
+	ptrSize  uint64
+}
+
+func newTypeResolver(known map[string]*client.DataType, ptrSize uint64) *typeResolver {
+	return &typeResolver{
+		known:    known,
+		resolved: map[string]*tinyelf.Type{},
+		ptrSize:  ptrSize,
+	}
+}
+
+// resolve returns type by decompiler name, size is used for types missing from known ones.
+// nil is returned for void and types of unknown size.
+func (r *typeResolver) resolve(name string, size uint64) *tinyelf.Type {
+	name = strings.TrimSpace(name)
+	if name == "" || name == "void" {
+		return nil
+	}
+
+	if dt, ok := r.known[name]; ok {
+		return r.known2tinyelf(dt)
+	}
+
+	switch {
+	case strings.HasSuffix(name, "*"):
+		key := name + "/ptr"
+		if t, ok := r.resolved[key]; ok {
+			return t
+		}
+
+		t := &tinyelf.Type{Kind: tinyelf.KindPointer, Size: r.ptrSize}
+		r.resolved[key] = t
+		t.Target = r.resolve(strings.TrimSuffix(name, "*"), 0)
+
+		return t
+	case arrayRe.MatchString(name):
+		m := arrayRe.FindStringSubmatch(name)
+		count, _ := strconv.ParseUint(m[2], 10, 64)
+		key := name + "/array"
+		if t, ok := r.resolved[key]; ok {
+			return t
+		}
+
+		var elemSize uint64
+		if count > 0 {
+			elemSize = size / count
+		}
+
+		elem := r.resolve(m[1], elemSize)
+		if elem == nil {
+			return nil
+		}
+
+		t := &tinyelf.Type{Kind: tinyelf.KindArray, Target: elem, Count: count}
+		r.resolved[key] = t
+
+		return t
+	}
+
+	if size == 0 {
+		return nil
+	}
+
+	key := fmt.Sprintf("%s/%d", name, size)
+	if t, ok := r.resolved[key]; ok {
+		return t
+	}
+
+	t := &tinyelf.Type{Kind: tinyelf.KindBase, Name: name, Size: size, Encoding: baseEncoding(name)}
+	r.resolved[key] = t
+
+	return t
+}
+
+func (r *typeResolver) known2tinyelf(dt *client.DataType) *tinyelf.Type {
+	key := dt.Name + "/known"
+	if t, ok := r.resolved[key]; ok {
+		return t
+	}
+
+	t := &tinyelf.Type{Name: dt.Name, Size: dt.Size}
+	// stored before resolving members to break cycles
+	r.resolved[key] = t
+
+	switch dt.Kind {
+	case client.KindPointer:
+		t.Kind = tinyelf.KindPointer
+		t.Name = ""
+		t.Target = r.resolve(dt.Target, 0)
+		if t.Size == 0 {
+			t.Size = r.ptrSize
+		}
+	case client.KindStruct, client.KindUnion:
+		t.Kind = tinyelf.KindStruct
+		if dt.Kind == client.KindUnion {
+			t.Kind = tinyelf.KindUnion
+		}
+
+		for _, m := range dt.Members {
+			t.Members = append(t.Members, &tinyelf.Member{Name: m.Name, Type: r.resolve(m.Type, 0), Offset: m.Offset})
+		}
+	case client.KindEnum:
+		t.Kind = tinyelf.KindEnum
+		for _, e := range dt.Enumerators {
+			t.Enumerators = append(t.Enumerators, &tinyelf.Enumerator{Name: e.Name, Value: e.Value})
+		}
+	case client.KindTypedef:
+		t.Kind = tinyelf.KindTypedef
+		t.Target = r.resolve(dt.Target, dt.Size)
+	case client.KindArray:
+		t.Kind = tinyelf.KindArray
+		t.Name = ""
+		t.Count = dt.Count
+
+		var elemSize uint64
+		if dt.Count > 0 {
+			elemSize = dt.Size / dt.Count
+		}
+		t.Target = r.resolve(dt.Target, elemSize)
+	default:
+		t.Kind = tinyelf.KindBase
+		t.Encoding = encoding(dt.Encoding, dt.Name)
+	}
+
+	return t
+}
+
+func encoding(enc string, name string) uint8 {
+	switch enc {
+	case client.EncodingSigned:
+		return tinyelf.EncodingSigned
+	case client.EncodingUnsigned:
+		return tinyelf.EncodingUnsigned
+	case client.EncodingFloat:
+		return tinyelf.EncodingFloat
+	case client.EncodingBool:
+		return tinyelf.EncodingBoolean
+	case client.EncodingChar:
+		return tinyelf.EncodingSignedChar
+	case client.EncodingUChar:
+		return tinyelf.EncodingUnsignedChar
+	}
+
+	return baseEncoding(name)
+}
+
+// baseEncoding guesses DW_ATE encoding from decompiler type name.
+func baseEncoding(name string) uint8 {
+	n := strings.ToLower(name)
+
+	switch {
+	case strings.HasSuffix(n, "*"), strings.Contains(n, "pointer"):
+		return tinyelf.EncodingAddress
+	case strings.Contains(n, "bool"):
+		return tinyelf.EncodingBoolean
+	case strings.Contains(n, "float"), strings.Contains(n, "double"):
+		return tinyelf.EncodingFloat
+	case n == "char", n == "signed char":
+		return tinyelf.EncodingSignedChar
+	case n == "uchar", n == "unsigned char", n == "byte":
+		return tinyelf.EncodingUnsignedChar
+	case strings.HasPrefix(n, "u"), strings.HasPrefix(n, "dword"), strings.HasPrefix(n, "word"), strings.HasPrefix(n, "qword"):
+		return tinyelf.EncodingUnsigned
+	}
+
+	return tinyelf.EncodingSigned
+}
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"decompelf/src/decomp2dbg/client"
+	"testing"
+)
+
+func TestResolveTypedefCycle(t *testing.T) {
+	known := map[string]*client.DataType{
+		"a_t":    {Name: "a_t", Kind: client.KindTypedef, Target: "b_t"},
+		"b_t":    {Name: "b_t", Kind: client.KindTypedef, Target: "a_t"},
+		"self_t": {Name: "self_t", Kind: client.KindTypedef, Target: "self_t"},
+		"arr_t":  {Name: "arr_t", Kind: client.KindArray, Target: "arr_t", Count: 4},
+		"int_t":  {Name: "int_t", Kind: client.KindTypedef, Target: "uint"},
+		"uint":   {Name: "uint", Kind: client.KindBase, Size: 4, Encoding: client.EncodingUnsigned},
+	}
+	r := newTypeResolver(known, 8)
+
+	tests := map[string]uint64{"a_t": 0, "b_t": 0, "self_t": 0, "arr_t": 0, "int_t": 4, "int_t[3]": 12}
+	for name, want := range tests {
+		if got := r.resolve(name, 0).ByteSize(); got != want {
+			t.Errorf("%s: got size %d, want %d", name, got, want)
+		}
+	}
+
+	// unknown type size falls back to reported one
+	g := &client.GlobalVar{Name: "x", Type: "a_t", Size: 16}
+	if got := r.size(g); got != 16 {
+		t.Errorf("global of cyclic type: got size %d, want 16", got)
+	}
+}
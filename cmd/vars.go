@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"debug/elf"
+	"decompelf/src/decomp2dbg/client"
+	"decompelf/src/tinyelf"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// functionData fetches arguments and local variables of function, nil if server failed to provide them.
+func functionData(ctx context.Context, d client.D2D, s *client.FunctionHeader) (*client.FunctionData, error) {
+	data, err := d.FunctionData(ctx, s.Value)
+	if err != nil {
+		var fault *client.FaultError
+		if errors.As(err, &fault) {
+			slog.Warn("failed to get function data", "name", s.Name, "address", fmt.Sprintf("0x%x", s.Value), "error", err.Error())
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to get function data for %s: %w", s.Name, err)
+	}
+
+	return data, nil
+}
+
+// addFunctionData adds arguments and local variables of f.
+// Stack variables are relative to CFA if target has call frame information,
+// otherwise to stack pointer, which is correct at function entry only.
+func addFunctionData(data *client.FunctionData, f *tinyelf.Function, machine elf.Machine, types *typeResolver, cfi bool) {
+	sp, hasSP := DWARFRegister(machine, stackPointers[machine])
+
+	convert := func(vars []*client.Variable) []*tinyelf.Variable {
+		result := []*tinyelf.Variable{}
+		for _, v := range vars {
+			tv := &tinyelf.Variable{Name: v.Name, Type: types.resolve(v.Type, v.Size)}
+
+			switch {
+			case v.Register != "":
+				if reg, ok := DWARFRegister(machine, v.Register); ok {
+					tv.Location = tinyelf.LocRegister(reg)
+				}
+			case v.HasOffset && cfi:
+				tv.Location = tinyelf.LocFrameBase(v.Offset - stackReturnAddressSize[machine])
+				f.FrameBase = tinyelf.FrameBaseCFA
+			case v.HasOffset && hasSP:
+				tv.Location = tinyelf.LocFrameBase(v.Offset)
+				f.FrameBase = tinyelf.FrameBaseRegister(sp)
+			}
+
+			result = append(result, tv)
+		}
+
+		return result
+	}
+
+	f.Params = convert(data.Args)
+	f.Locals = append(convert(data.StackVars), convert(data.RegVars)...)
+}
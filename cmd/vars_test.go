@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"bytes"
+	"debug/elf"
+	"decompelf/src/decomp2dbg/client"
+	"decompelf/src/tinyelf"
+	"testing"
+)
+
+func TestAddFunctionData(t *testing.T) {
+	tests := []struct {
+		machine   elf.Machine
+		cfi       bool
+		frameBase []byte
+		location  []byte
+	}{
+		// return address is at entry stack pointer, CFA is above it
+		{elf.EM_X86_64, true, tinyelf.FrameBaseCFA, tinyelf.LocFrameBase(-0x18)},
+		{elf.EM_386, true, tinyelf.FrameBaseCFA, tinyelf.LocFrameBase(-0x14)},
+		// return address is in link register, CFA is entry stack pointer
+		{elf.EM_ARM, true, tinyelf.FrameBaseCFA, tinyelf.LocFrameBase(-0x10)},
+		{elf.EM_AARCH64, true, tinyelf.FrameBaseCFA, tinyelf.LocFrameBase(-0x10)},
+		// no call frame information, DW_OP_breg of stack pointer
+		{elf.EM_X86_64, false, []byte{0x77, 0}, tinyelf.LocFrameBase(-0x10)},
+		{elf.EM_386, false, []byte{0x74, 0}, tinyelf.LocFrameBase(-0x10)},
+		{elf.EM_ARM, false, []byte{0x7d, 0}, tinyelf.LocFrameBase(-0x10)},
+		{elf.EM_AARCH64, false, []byte{0x8f, 0}, tinyelf.LocFrameBase(-0x10)},
+		{elf.EM_RISCV, false, []byte{0x72, 0}, tinyelf.LocFrameBase(-0x10)},
+		// unknown stack pointer, variable is optimized out
+		{elf.EM_SPARC, false, nil, nil},
+	}
+
+	data := &client.FunctionData{StackVars: []*client.Variable{{Name: "local_10", Type: "int", Size: 4, HasOffset: true, Offset: -0x10}}}
+	types := newTypeResolver(nil, 8)
+	for _, tt := range tests {
+		f := &tinyelf.Function{Name: "f"}
+		addFunctionData(data, f, tt.machine, types, tt.cfi)
+
+		if !bytes.Equal(f.FrameBase, tt.frameBase) || !bytes.Equal(f.Locals[0].Location, tt.location) {
+			t.Errorf("%s, cfi %v: got frame base %x, location %x, want %x, %x", tt.machine, tt.cfi,
+				f.FrameBase, f.Locals[0].Location, tt.frameBase, tt.location)
+		}
+	}
+}
+
+func TestFrameBaseRegister(t *testing.T) {
+	if got := tinyelf.FrameBaseRegister(65); !bytes.Equal(got, []byte{0x92, 65, 0}) {
+		t.Errorf("got %x", got)
+	}
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"context"
+	"decompelf/src/decomp2dbg/client"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// snapshot is a set of decompiler symbols keyed by kind and address.
+type snapshot map[string]snapshotSymbol
+
+type snapshotSymbol struct {
+	Kind    string `json:"kind"`
+	Address uint64 `json:"address"`
+	Name    string `json:"name"`
+	Size    uint64 `json:"size,omitempty"`
+	Type    string `json:"type,omitempty"`
+}
+
+func symbolKey(kind string, address uint64) string {
+	return fmt.Sprintf("%s/%x", kind, address)
+}
+
+func takeSnapshot(ctx context.Context, d client.D2D) (snapshot, error) {
+	fh, err := d.FunctionHeaders(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get function headers: %w", err)
+	}
+
+	gv, err := d.GlobalVars(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get global vars: %w", err)
+	}
+
+	result := snapshot{}
+	for _, f := range fh {
+		result[symbolKey("function", f.Value)] = snapshotSymbol{Kind: "function", Address: f.Value, Name: f.Name, Size: f.Size}
+	}
+
+	for _, g := range gv {
+		result[symbolKey("global", g.Value)] = snapshotSymbol{Kind: "global", Address: g.Value, Name: g.Name, Size: g.Size, Type: g.Type}
+	}
+
+	return result, nil
+}
+
+// symbolChange is a symbol added, removed, renamed or changed between snapshots, From is previous name.
+type symbolChange struct {
+	Action string
+	Symbol snapshotSymbol
+	From   string
+}
+
+// diff logs and returns symbols added, removed, renamed and changed since old, sorted by address.
+func (s snapshot) diff(old snapshot) []symbolChange {
+	changes := []symbolChange{}
+	for key, sym := range s {
+		prev, ok := old[key]
+		switch {
+		case !ok:
+			changes = append(changes, symbolChange{Action: "added", Symbol: sym})
+		case prev.Name != sym.Name:
+			changes = append(changes, symbolChange{Action: "renamed", Symbol: sym, From: prev.Name})
+		case prev != sym:
+			changes = append(changes, symbolChange{Action: "changed", Symbol: sym})
+		}
+	}
+
+	for key, prev := range old {
+		if _, ok := s[key]; !ok {
+			changes = append(changes, symbolChange{Action: "removed", Symbol: prev})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i].Symbol, changes[j].Symbol
+		if a.Address != b.Address {
+			return a.Address < b.Address
+		}
+
+		return a.Kind < b.Kind
+	})
+
+	for _, c := range changes {
+		address := fmt.Sprintf("0x%x", c.Symbol.Address)
+		if c.Action == "renamed" {
+			slog.Info(c.Action, "kind", c.Symbol.Kind, "from", c.From, "to", c.Symbol.Name, "address", address)
+		} else {
+			slog.Info(c.Action, "kind", c.Symbol.Kind, "name", c.Symbol.Name, "address", address)
+		}
+	}
+
+	return changes
+}
+
+// Watch polls decomp2dbg server every interval and regenerates cfg.Out when functions or globals change.
+// Output is replaced atomically, gdb script reloading it is written to script if set.
+func Watch(ctx context.Context, cfg Config, d client.D2D, interval time.Duration, script string) error {
+	out := cfg.Out
+	cfg.Out = out + ".tmp"
+
+	var last snapshot
+	for {
+		current, err := takeSnapshot(ctx, d)
+		changed := err == nil && (last == nil || len(current.diff(last)) > 0)
+		if changed {
+			if err = Run(ctx, cfg, d); err == nil {
+				err = os.Rename(cfg.Out, out)
+			}
+		}
+
+		switch {
+		case err != nil && last == nil:
+			return err
+		case err != nil:
+			slog.Warn("failed to regenerate tiny elf", "error", err.Error())
+		case changed:
+			last = current
+			slog.Info("written", "path", out, "symbols", len(current))
+
+			if script != "" {
+				if err = writeReloadScript(script, out); err != nil {
+					return err
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// writeReloadScript writes gdb script replacing previously loaded symbol file at path.
+func writeReloadScript(script string, path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	data := fmt.Sprintf(`python
+try:
+    gdb.execute("remove-symbol-file %[1]s")
+except gdb.error:
+    pass
+end
+add-symbol-file %[1]s
+`, path)
+
+	if err = os.WriteFile(script, []byte(data), 0644); err != nil {
+		return fmt.Errorf("failed to write gdb script: %w", err)
+	}
+
+	return nil
+}
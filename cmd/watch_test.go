@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"debug/elf"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	old := snapshot{
+		symbolKey("function", 0x1000): {Kind: "function", Address: 0x1000, Name: "FUN_00001000", Size: 0x10},
+		symbolKey("function", 0x1010): {Kind: "function", Address: 0x1010, Name: "helper", Size: 0x10},
+		symbolKey("function", 0x1020): {Kind: "function", Address: 0x1020, Name: "gone", Size: 0x10},
+		symbolKey("global", 0x2000):   {Kind: "global", Address: 0x2000, Name: "counter", Size: 4, Type: "int"},
+	}
+
+	current := snapshot{
+		symbolKey("function", 0x1000): {Kind: "function", Address: 0x1000, Name: "init", Size: 0x10},
+		symbolKey("function", 0x1010): {Kind: "function", Address: 0x1010, Name: "helper", Size: 0x10},
+		symbolKey("function", 0x1030): {Kind: "function", Address: 0x1030, Name: "added", Size: 8},
+		symbolKey("global", 0x2000):   {Kind: "global", Address: 0x2000, Name: "counter", Size: 4, Type: "uint"},
+		// same address, other kind
+		symbolKey("global", 0x1010): {Kind: "global", Address: 0x1010, Name: "table"},
+	}
+
+	got := []string{}
+	for _, c := range current.diff(old) {
+		got = append(got, c.Action+" "+c.From+" "+c.Symbol.Name)
+	}
+
+	want := []string{
+		"renamed FUN_00001000 init",
+		"added  table",
+		"removed  gone",
+		"added  added",
+		"changed  counter",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if changes := current.diff(current); len(changes) != 0 {
+		t.Errorf("same snapshot: got %+v", changes)
+	}
+}
+
+func TestWriteReloadScript(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "reload.gdb")
+	if err := writeReloadScript(script, filepath.Join(dir, "sub", "..", "tinyelf")); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "tinyelf")
+	want := `python
+try:
+    gdb.execute("remove-symbol-file ` + path + `")
+except gdb.error:
+    pass
+end
+add-symbol-file ` + path + `
+`
+	if got, _ := os.ReadFile(script); string(got) != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	if err := writeReloadScript(filepath.Join(dir, "missing", "reload.gdb"), path); err == nil {
+		t.Errorf("got no error for missing directory")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.SourceDir = t.TempDir()
+	script := cfg.Out + ".gdb"
+	if err := os.WriteFile(cfg.Out, []byte("previous output"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- Watch(ctx, cfg, newServer(t).Client(), 10*time.Millisecond, script) }()
+
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(script); err == nil {
+			break
+		}
+	}
+	cancel()
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// output is replaced by rename of temporary file
+	if f := open(t, cfg.Out); f.Type != elf.ET_REL {
+		t.Errorf("got %s", f.Type)
+	}
+
+	for _, tmp := range []string{cfg.Out + ".tmp", filepath.Join(cfg.SourceDir, "prog.c.tmp")} {
+		if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+			t.Errorf("%s is left: %v", tmp, err)
+		}
+	}
+
+	if src, err := os.ReadFile(filepath.Join(cfg.SourceDir, "prog.c")); err != nil || len(src) == 0 {
+		t.Errorf("source: got %q, %v", src, err)
+	}
+}
@@ -2,308 +2,330 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"debug/elf"
-	"encoding/xml"
+	"decompelf/src/decomp2dbg/xmlrpc"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
-type Client struct {
-	URL string
+const (
+	DefaultMaxResponseSize = 256 << 20
+	DefaultRetryBackoff    = 500 * time.Millisecond
+)
+
+var ErrResponseTooLarge = errors.New("response too large")
+
+// idempotent methods are retried on transport errors and 5xx replies.
+var idempotent = map[string]bool{
+	"d2d.ping":             true,
+	"d2d.elf_info":         true,
+	"d2d.function_headers": true,
+	"d2d.global_vars":      true,
+	"d2d.getImageBase":     true,
+	"d2d.decompile":        true,
+	"d2d.function_data":    true,
+	"d2d.data_types":       true,
+	"d2d.memory_map":       true,
 }
 
-type PingRequest struct{}
-type PingReply struct {
-	XMLName xml.Name `xml:"methodResponse"`
-	Text    string   `xml:",chardata"`
-	Params  struct {
-		Text  string `xml:",chardata"`
-		Param struct {
-			Text  string `xml:",chardata"`
-			Value struct {
-				Text    string `xml:",chardata"`
-				Boolean string `xml:"boolean"`
-			} `xml:"value"`
-		} `xml:"param"`
-	} `xml:"params"`
+// D2D is a set of decomp2dbg calls used by decompelf, implemented by Client.
+type D2D interface {
+	Ping(ctx context.Context) (bool, error)
+	ElfInfo(ctx context.Context) (*ElfInfo, error)
+	FunctionHeaders(ctx context.Context) ([]*FunctionHeader, error)
+	GlobalVars(ctx context.Context) ([]*GlobalVar, error)
+	GetImageBase(ctx context.Context) (uint64, error)
+	Decompile(ctx context.Context, addr uint64) (*Decompilation, error)
+	FunctionData(ctx context.Context, addr uint64) (*FunctionData, error)
+	DataTypes(ctx context.Context) (map[string]*DataType, error)
+	MemoryMap(ctx context.Context) ([]*MemoryBlock, error)
 }
 
-func (c *Client) Ping() (*PingReply, error) {
-	req := []byte("<methodCall><methodName>d2d.ping</methodName><params></params></methodCall>")
+var _ D2D = (*Client)(nil)
+
+type Client struct {
+	URL string
+	// HTTPClient is used for all requests, http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// Timeout limits every attempt, no limit if zero.
+	Timeout time.Duration
+	// Retries is a number of additional attempts for idempotent methods, negative is the same as zero.
+	Retries int
+	// RetryBackoff is a delay before first retry, doubled on each next one.
+	RetryBackoff time.Duration
+	// MaxResponseSize limits response body, DefaultMaxResponseSize if zero.
+	MaxResponseSize int64
+}
 
-	resp, err := http.Post(c.URL, "text/xml", bytes.NewBuffer(req))
+// Call invokes XML-RPC method with args and decodes result into out, see xmlrpc.Unmarshal.
+// out may be nil if result is not needed.
+// Returned errors are one of *TransportError, *HTTPStatusError, *FaultError, *MalformedResponseError.
+func (c *Client) Call(ctx context.Context, method string, out any, args ...any) error {
+	req, err := xmlrpc.EncodeCall(method, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send ping request: %w", err)
+		return fmt.Errorf("failed to encode %s request: %w", method, err)
 	}
-	defer resp.Body.Close()
 
-	reply := &PingReply{}
+	attempts := 1
+	if idempotent[method] && c.Retries > 0 {
+		attempts += c.Retries
+	}
+
+	backoff := c.RetryBackoff
+	if backoff == 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	var body []byte
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return &TransportError{Method: method, Err: ctx.Err()}
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		body, err = c.post(ctx, method, req)
+		if err == nil || !retryable(ctx, err) {
+			break
+		}
+	}
 
-	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	err = xml.Unmarshal(body, reply)
+	v, err := xmlrpc.DecodeResponse(body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode ping response: %w", err)
+		var fault *xmlrpc.Fault
+		if errors.As(err, &fault) {
+			return &FaultError{Method: method, Code: fault.Code, String: fault.String}
+		}
+
+		return &MalformedResponseError{Method: method, Err: err}
 	}
 
-	return reply, nil
+	if out == nil {
+		return nil
+	}
+
+	return decode(method, v, out, false)
 }
 
-type FunctionHeadersRequest struct{}
+func (c *Client) post(ctx context.Context, method string, req []byte) ([]byte, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
 
-type FunctionHeader struct {
-	Name  string
-	Size  int
-	Value int
-}
-
-type FunctionHeadersReply struct {
-	XMLName xml.Name `xml:"methodResponse"`
-	Text    string   `xml:",chardata"`
-	Params  struct {
-		Text  string `xml:",chardata"`
-		Param struct {
-			Text  string `xml:",chardata"`
-			Value struct {
-				Text   string `xml:",chardata"`
-				Struct struct {
-					Text   string `xml:",chardata"`
-					Member []struct {
-						Text  string `xml:",chardata"`
-						Name  string `xml:"name"`
-						Value struct {
-							Text   string `xml:",chardata"`
-							Struct struct {
-								Text   string `xml:",chardata"`
-								Member []struct {
-									Text  string `xml:",chardata"`
-									Name  string `xml:"name"`
-									Value struct {
-										Text string `xml:",chardata"`
-										I4   string `xml:"i4"`
-									} `xml:"value"`
-								} `xml:"member"`
-							} `xml:"struct"`
-						} `xml:"value"`
-					} `xml:"member"`
-				} `xml:"struct"`
-			} `xml:"value"`
-		} `xml:"param"`
-	} `xml:"params"`
-}
-
-func (c *Client) FunctionHeaders() ([]*FunctionHeader, error) {
-	req := []byte("<methodCall><methodName>d2d.function_headers</methodName><params></params></methodCall>")
-
-	resp, err := http.Post(c.URL, "text/xml", bytes.NewBuffer(req))
-	if err != nil {
-		return nil, fmt.Errorf("failed to send function headers request: %w", err)
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
 	}
-	defer resp.Body.Close()
 
-	reply := &FunctionHeadersReply{}
+	maxSize := c.MaxResponseSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxResponseSize
+	}
 
-	body, err := io.ReadAll(resp.Body)
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(req))
 	if err != nil {
-		return nil, fmt.Errorf("cannot read function vars response body")
+		return nil, &TransportError{Method: method, Err: err}
 	}
+	r.Header.Set("Content-Type", "text/xml")
 
-	err = xml.Unmarshal(body, reply)
-	if err != nil {
-		panic(err)
+	resp, err := hc.Do(r)
+	if errors.Is(err, ErrNotRecorded) {
+		return nil, &NotRecordedError{Method: method}
 	}
 
-	result := []*FunctionHeader{}
+	if err != nil {
+		return nil, &TransportError{Method: method, Err: err}
+	}
+	defer resp.Body.Close()
 
-	for _, v := range reply.Params.Param.Value.Struct.Member {
-		name, _ := strings.CutPrefix(v.Name, "0x")
-		value, err2 := strconv.ParseUint(name, 16, 32)
-		if err2 != nil {
-			return nil, fmt.Errorf("failed to parse function address %s: %w", v.Name, err2)
-		}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, &TransportError{Method: method, Err: err}
+	}
 
-		fh := &FunctionHeader{
-			Value: int(value),
-		}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPStatusError{Method: method, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
 
-		for _, p := range v.Value.Struct.Member {
-			switch p.Name {
-			case "name":
-				fh.Name = p.Value.Text
-			case "size":
-				size, err3 := strconv.Atoi(p.Value.I4)
-				if err3 != nil {
-					return nil, fmt.Errorf("cannot parse function size %s: %w", p.Value.I4, err3)
-				}
+	if int64(len(body)) > maxSize {
+		return nil, &MalformedResponseError{Method: method, Err: fmt.Errorf("%w: limit is %d bytes", ErrResponseTooLarge, maxSize)}
+	}
 
-				fh.Size = size
+	return body, nil
+}
 
-			}
-		}
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrNotRecorded) {
+		return false
+	}
 
-		result = append(result, fh)
+	var transport *TransportError
+	if errors.As(err, &transport) {
+		return true
 	}
 
-	return result, nil
-}
+	var status *HTTPStatusError
+	if errors.As(err, &status) {
+		return status.StatusCode >= 500 || status.StatusCode == http.StatusTooManyRequests
+	}
 
-type GlobalVarsReply struct {
-	XMLName xml.Name `xml:"methodResponse"`
-	Text    string   `xml:",chardata"`
-	Params  struct {
-		Text  string `xml:",chardata"`
-		Param struct {
-			Text  string `xml:",chardata"`
-			Value struct {
-				Text   string `xml:",chardata"`
-				Struct struct {
-					Text   string `xml:",chardata"`
-					Member []struct {
-						Text  string `xml:",chardata"`
-						Name  string `xml:"name"`
-						Value struct {
-							Text   string `xml:",chardata"`
-							Struct struct {
-								Text   string `xml:",chardata"`
-								Member struct {
-									Text  string `xml:",chardata"`
-									Name  string `xml:"name"`
-									Value string `xml:"value"`
-								} `xml:"member"`
-							} `xml:"struct"`
-						} `xml:"value"`
-					} `xml:"member"`
-				} `xml:"struct"`
-			} `xml:"value"`
-		} `xml:"param"`
-	} `xml:"params"`
+	return false
 }
 
-type GlobalVar struct {
-	Name  string
-	Value int
-}
+// decode converts xmlrpc.Unmarshal errors into client errors.
+func decode(method string, v any, out any, strict bool) error {
+	var err error
+	if strict {
+		err = xmlrpc.UnmarshalStrict(v, out)
+	} else {
+		err = xmlrpc.Unmarshal(v, out)
+	}
 
-func (c *Client) GlobalVars() ([]*GlobalVar, error) {
-	req := []byte("<methodCall><methodName>d2d.global_vars</methodName><params></params></methodCall>")
+	if err == nil {
+		return nil
+	}
 
-	resp, err := http.Post(c.URL, "text/xml", bytes.NewBuffer(req))
-	if err != nil {
-		return nil, fmt.Errorf("failed to send global vars request: %w", err)
+	var unknown *xmlrpc.UnknownFieldError
+	if errors.As(err, &unknown) {
+		return &UnexpectedFieldError{Method: method, Field: unknown.Field}
 	}
-	defer resp.Body.Close()
 
-	reply := &GlobalVarsReply{}
+	return &MalformedResponseError{Method: method, Err: err}
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("cannot read global vars response body")
+func (c *Client) Ping(ctx context.Context) (bool, error) {
+	var reply bool
+	if err := c.Call(ctx, "d2d.ping", &reply); err != nil {
+		return false, err
 	}
 
-	err = xml.Unmarshal(body, reply)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal global vars: %w", err)
-	}
+	return reply, nil
+}
 
-	result := []*GlobalVar{}
+type FunctionHeader struct {
+	Name  string
+	Size  uint64
+	Value uint64
+}
 
-	for _, v := range reply.Params.Param.Value.Struct.Member {
-		vv, _ := strings.CutPrefix(v.Name, "0x")
-		value, err2 := strconv.ParseUint(vv, 16, 32)
-		if err2 != nil {
-			return nil, fmt.Errorf("failed to parse %s: %w", v.Name, err2)
-		}
+type functionHeaderReply struct {
+	Name string `xmlrpc:"name"`
+	Size uint64 `xmlrpc:"size"`
+}
+
+// FunctionHeaders returns functions sorted by address.
+func (c *Client) FunctionHeaders(ctx context.Context) ([]*FunctionHeader, error) {
+	reply := map[string]functionHeaderReply{}
+	if err := c.Call(ctx, "d2d.function_headers", &reply); err != nil {
+		return nil, err
+	}
+
+	result := []*FunctionHeader{}
 
-		fh := &GlobalVar{
-			Value: int(value),
-			Name:  v.Value.Struct.Member.Value,
+	for addr, v := range reply {
+		value, err := HexToUint64(addr)
+		if err != nil {
+			return nil, &MalformedResponseError{Method: "d2d.function_headers", Err: err}
 		}
 
-		result = append(result, fh)
+		result = append(result, &FunctionHeader{
+			Name:  v.Name,
+			Size:  v.Size,
+			Value: value,
+		})
 	}
 
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Value < result[j].Value
+	})
+
 	return result, nil
 }
 
-type ImageBaseReply struct {
-	XMLName xml.Name `xml:"methodResponse"`
-	Text    string   `xml:",chardata"`
-	Params  struct {
-		Text  string `xml:",chardata"`
-		Param struct {
-			Text  string `xml:",chardata"`
-			Value string `xml:"value"`
-		} `xml:"param"`
-	} `xml:"params"`
+type GlobalVar struct {
+	Name  string
+	Value uint64
+	// Type is a data type name, see DataTypes. Type and Size are empty if server does not report them.
+	Type string
+	Size uint64
 }
 
-func (c *Client) GetImageBase() (int, error) {
-	req := []byte("<methodCall><methodName>d2d.getImageBase</methodName><params></params></methodCall>")
+type globalVarReply struct {
+	Name string `xmlrpc:"name"`
+	Type string `xmlrpc:"type"`
+	Size uint64 `xmlrpc:"size"`
+}
 
-	resp, err := http.Post(c.URL, "text/xml", bytes.NewBuffer(req))
-	if err != nil {
-		return 0, fmt.Errorf("failed to send ping request: %w", err)
+// GlobalVars returns global variables sorted by address.
+func (c *Client) GlobalVars(ctx context.Context) ([]*GlobalVar, error) {
+	reply := map[string]globalVarReply{}
+	if err := c.Call(ctx, "d2d.global_vars", &reply); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	reply := &ImageBaseReply{}
+	result := []*GlobalVar{}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
+	for addr, v := range reply {
+		value, err := HexToUint64(addr)
+		if err != nil {
+			return nil, &MalformedResponseError{Method: "d2d.global_vars", Err: err}
+		}
+
+		result = append(result, &GlobalVar{
+			Value: value,
+			Name:  v.Name,
+			Type:  v.Type,
+			Size:  v.Size,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Value < result[j].Value
+	})
+
+	return result, nil
+}
+
+func (c *Client) GetImageBase(ctx context.Context) (uint64, error) {
+	var reply any
+	if err := c.Call(ctx, "d2d.getImageBase", &reply); err != nil {
 		return 0, err
 	}
 
-	err = xml.Unmarshal(body, reply)
-	if err != nil {
-		return 0, fmt.Errorf("failed to decode ping response: %w", err)
+	switch v := reply.(type) {
+	case int64:
+		return uint64(v), nil
+	case string:
+		base, err := HexToUint64(v)
+		if err != nil {
+			return 0, &MalformedResponseError{Method: "d2d.getImageBase", Err: err}
+		}
+
+		return base, nil
 	}
 
-	v, _ := strings.CutPrefix(reply.Params.Param.Value, "0x")
-	base, err := strconv.ParseInt(v, 16, 32)
-	if err != nil {
-		return 0, fmt.Errorf("failed to parse %s into int: %w", reply.Params.Param.Value, err)
-	}
-
-	return int(base), nil
-}
-
-type ElfInfoResp struct {
-	XMLName xml.Name `xml:"methodResponse"`
-	Text    string   `xml:",chardata"`
-	Params  struct {
-		Text  string `xml:",chardata"`
-		Param struct {
-			Text  string `xml:",chardata"`
-			Value struct {
-				Text   string `xml:",chardata"`
-				Struct struct {
-					Text   string `xml:",chardata"`
-					Member []struct {
-						Text  string `xml:",chardata"`
-						Name  string `xml:"name"`
-						Value struct {
-							Text    string `xml:",chardata"`
-							I4      int    `xml:"i4"`
-							Boolean bool   `xml:"boolean"`
-							Value   string `xml:"value"`
-						} `xml:"value"`
-					} `xml:"member"`
-				} `xml:"struct"`
-			} `xml:"value"`
-		} `xml:"param"`
-	} `xml:"params"`
+	return 0, &MalformedResponseError{Method: "d2d.getImageBase", Err: fmt.Errorf("unexpected image base value %v", reply)}
 }
 
 type ElfInfo struct {
 	Machine     elf.Machine
-	ImageBase   int
+	ImageBase   uint64
 	Error       error
 	Flags       int
 	IsBigEndian bool
@@ -311,75 +333,298 @@ type ElfInfo struct {
 	Name        string
 }
 
-func HexToInt(hex string) (int, error) {
-	v, _ := strings.CutPrefix(hex, "0x")
-	i, err := strconv.ParseInt(v, 16, 32)
+type elfInfoReply struct {
+	Error       string `xmlrpc:"error"`
+	Machine     int    `xmlrpc:"machine"`
+	IsBigEndian bool   `xmlrpc:"is_big_endian"`
+	Flags       int    `xmlrpc:"flags,hex"`
+	ImageBase   uint64 `xmlrpc:"image_base,hex"`
+	Is32Bit     bool   `xmlrpc:"is_32_bit"`
+	Name        string `xmlrpc:"name"`
+}
+
+func HexToUint64(hex string) (uint64, error) {
+	v := hex
+	if len(v) > 2 && strings.ToLower(v[:2]) == "0x" {
+		v = v[2:]
+	}
+
+	i, err := strconv.ParseUint(v, 16, 64)
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse %s into int: %w", hex, err)
+		return 0, fmt.Errorf("failed to parse %s into uint64: %w", hex, err)
 	}
 
-	return int(i), nil
+	return i, nil
 }
 
-func (c *Client) ElfInfo() (*ElfInfo, error) {
-	req := []byte("<methodCall><methodName>d2d.elf_info</methodName><params></params></methodCall>")
+func (c *Client) ElfInfo(ctx context.Context) (*ElfInfo, error) {
+	var v any
+	if err := c.Call(ctx, "d2d.elf_info", &v); err != nil {
+		return nil, err
+	}
 
-	resp, err := http.Post(c.URL, "text/xml", bytes.NewBuffer(req))
-	if err != nil {
-		return nil, fmt.Errorf("failed to send ping request: %w", err)
+	reply := &elfInfoReply{}
+	if err := decode("d2d.elf_info", v, reply, true); err != nil {
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	reply := &ElfInfoResp{}
+	if reply.Error != "" {
+		return nil, &FaultError{Method: "d2d.elf_info", String: reply.Error}
+	}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
+	elfInfo := &ElfInfo{
+		Machine:     elf.Machine(reply.Machine),
+		ImageBase:   reply.ImageBase,
+		Flags:       reply.Flags,
+		IsBigEndian: reply.IsBigEndian,
+		Is32Bit:     reply.Is32Bit,
+		Name:        reply.Name,
+	}
+
+	return elfInfo, nil
+}
+
+type Decompilation struct {
+	FuncName string
+	Lines    []string
+	// CurrLine is 0-based index of line with requested address, -1 if unknown.
+	CurrLine int
+	// AddrLines maps instruction addresses to 0-based line indexes, may be empty.
+	AddrLines map[uint64]int
+}
+
+type decompileReply struct {
+	Decompilation []string       `xmlrpc:"decompilation"`
+	CurrLine      int            `xmlrpc:"curr_line"`
+	FuncName      string         `xmlrpc:"func_name"`
+	AddrLines     map[string]int `xmlrpc:"addr_lines"`
+}
+
+// Decompile returns decompiled source of function containing addr.
+// addr is sent as signed 64-bit value, same as Ghidra address offsets.
+func (c *Client) Decompile(ctx context.Context, addr uint64) (*Decompilation, error) {
+	reply := &decompileReply{CurrLine: -1}
+	if err := c.Call(ctx, "d2d.decompile", reply, int64(addr)); err != nil {
 		return nil, err
 	}
 
-	err = xml.Unmarshal(body, reply)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode ping response: %w", err)
+	result := &Decompilation{
+		FuncName:  reply.FuncName,
+		Lines:     reply.Decompilation,
+		CurrLine:  reply.CurrLine,
+		AddrLines: map[uint64]int{},
 	}
 
-	elfInfo := &ElfInfo{
-		Machine:     0,
-		ImageBase:   0,
-		Error:       nil,
-		Flags:       0,
-		IsBigEndian: false,
-		Is32Bit:     false,
-		Name:        "",
-	}
-
-	for _, m := range reply.Params.Param.Value.Struct.Member {
-		switch m.Name {
-		case "error":
-			if m.Value.Text != "" {
-				return nil, errors.New(m.Value.Text)
+	for a, line := range reply.AddrLines {
+		value, err := HexToUint64(a)
+		if err != nil {
+			return nil, &MalformedResponseError{Method: "d2d.decompile", Err: err}
+		}
+
+		result.AddrLines[value] = line
+	}
+
+	return result, nil
+}
+
+type Variable struct {
+	Name string
+	Type string
+	Size uint64
+	// HasOffset is set if variable lives on stack at Offset from stack pointer at function entry.
+	HasOffset bool
+	Offset    int64
+	// Register holds variable, empty if none.
+	Register string
+}
+
+type FunctionData struct {
+	Args      []*Variable
+	StackVars []*Variable
+	RegVars   []*Variable
+}
+
+type variableReply struct {
+	Name   string `xmlrpc:"name"`
+	Type   string `xmlrpc:"type"`
+	Size   uint64 `xmlrpc:"size"`
+	Offset *int64 `xmlrpc:"offset"`
+	Reg    string `xmlrpc:"reg"`
+}
+
+type functionDataReply struct {
+	Args      map[string]variableReply `xmlrpc:"args"`
+	StackVars map[string]variableReply `xmlrpc:"stack_vars"`
+	RegVars   map[string]variableReply `xmlrpc:"reg_vars"`
+}
+
+// FunctionData returns arguments, stack and register variables of function at addr.
+// args are keyed by index, stack_vars by stack offset and reg_vars by register name;
+// offset and reg members take priority over keys.
+func (c *Client) FunctionData(ctx context.Context, addr uint64) (*FunctionData, error) {
+	reply := &functionDataReply{}
+	if err := c.Call(ctx, "d2d.function_data", reply, int64(addr)); err != nil {
+		return nil, err
+	}
+
+	result := &FunctionData{}
+
+	type indexed struct {
+		index int64
+		v     *Variable
+	}
+
+	collect := func(m map[string]variableReply, keyIsOffset bool) ([]*Variable, error) {
+		list := []indexed{}
+		for k, r := range m {
+			v := &Variable{Name: r.Name, Type: r.Type, Size: r.Size, Register: r.Reg}
+			// reg_vars keys are register names, sorted by variable name
+			index, err := strconv.ParseInt(k, 0, 64)
+			if err != nil && keyIsOffset {
+				return nil, &MalformedResponseError{Method: "d2d.function_data", Err: err}
+			}
+
+			if keyIsOffset {
+				v.HasOffset = true
+				v.Offset = index
 			}
-		case "machine":
-			elfInfo.Machine = elf.Machine(m.Value.I4)
-		case "is_big_endian":
-			elfInfo.IsBigEndian = m.Value.Boolean
-		case "flags":
-			elfInfo.Flags, err = HexToInt(m.Value.Text)
-			if err != nil {
-				return nil, fmt.Errorf("cannot parse elf flags %s: %w", m.Value.Text, err)
+
+			if r.Offset != nil {
+				v.HasOffset = true
+				v.Offset = *r.Offset
 			}
-		case "image_base":
-			elfInfo.ImageBase, err = HexToInt(m.Value.Text)
-			if err != nil {
-				return nil, fmt.Errorf("cannot parse image base %s: %w", m.Value.Text, err)
+
+			list = append(list, indexed{index: index, v: v})
+		}
+
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].index != list[j].index {
+				return list[i].index < list[j].index
 			}
-		case "is_32_bit":
-			elfInfo.Is32Bit = m.Value.Boolean
-		case "name":
-			elfInfo.Name = m.Value.Text
-		default:
-			return nil, fmt.Errorf("unexpected field %s", m.Name)
+			return list[i].v.Name < list[j].v.Name
+		})
+
+		vars := make([]*Variable, len(list))
+		for i, e := range list {
+			vars[i] = e.v
 		}
+
+		return vars, nil
 	}
 
-	return elfInfo, nil
+	var err error
+	if result.Args, err = collect(reply.Args, false); err != nil {
+		return nil, err
+	}
+
+	if result.StackVars, err = collect(reply.StackVars, true); err != nil {
+		return nil, err
+	}
+
+	for k, r := range reply.RegVars {
+		if r.Reg == "" {
+			r.Reg = k
+			reply.RegVars[k] = r
+		}
+	}
+
+	if result.RegVars, err = collect(reply.RegVars, false); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Data type kinds.
+const (
+	KindBase    = "base"
+	KindPointer = "pointer"
+	KindStruct  = "struct"
+	KindUnion   = "union"
+	KindEnum    = "enum"
+	KindTypedef = "typedef"
+	KindArray   = "array"
+)
+
+// Base type encodings.
+const (
+	EncodingSigned   = "signed"
+	EncodingUnsigned = "unsigned"
+	EncodingFloat    = "float"
+	EncodingBool     = "bool"
+	EncodingChar     = "char"
+	EncodingUChar    = "uchar"
+)
+
+type DataTypeMember struct {
+	Name   string `xmlrpc:"name"`
+	Type   string `xmlrpc:"type"`
+	Offset uint64 `xmlrpc:"offset"`
+}
+
+type Enumerator struct {
+	Name  string `xmlrpc:"name"`
+	Value int64  `xmlrpc:"value"`
+}
+
+// DataType describes named data type, other types are referenced by name.
+type DataType struct {
+	Name string `xmlrpc:"-"`
+	Kind string `xmlrpc:"kind"`
+	Size uint64 `xmlrpc:"size"`
+	// Encoding is set for base types.
+	Encoding string `xmlrpc:"encoding"`
+	// Target is pointed to, aliased or array element type.
+	Target      string           `xmlrpc:"target"`
+	Count       uint64           `xmlrpc:"count"`
+	Members     []DataTypeMember `xmlrpc:"members"`
+	Enumerators []Enumerator     `xmlrpc:"enumerators"`
+}
+
+// DataTypes returns data types used by program keyed by name.
+func (c *Client) DataTypes(ctx context.Context) (map[string]*DataType, error) {
+	reply := map[string]*DataType{}
+	if err := c.Call(ctx, "d2d.data_types", &reply); err != nil {
+		return nil, err
+	}
+
+	for name, t := range reply {
+		if t == nil {
+			return nil, &MalformedResponseError{Method: "d2d.data_types", Err: fmt.Errorf("empty type %s", name)}
+		}
+
+		t.Name = name
+	}
+
+	return reply, nil
+}
+
+// MemoryBlock is a program memory block as shown in decompiler memory map.
+type MemoryBlock struct {
+	Name    string `xmlrpc:"name"`
+	Start   uint64 `xmlrpc:"start,hex"`
+	Size    uint64 `xmlrpc:"size"`
+	Read    bool   `xmlrpc:"read"`
+	Write   bool   `xmlrpc:"write"`
+	Execute bool   `xmlrpc:"execute"`
+}
+
+// MemoryMap returns memory blocks sorted by start address.
+func (c *Client) MemoryMap(ctx context.Context) ([]*MemoryBlock, error) {
+	reply := []*MemoryBlock{}
+	if err := c.Call(ctx, "d2d.memory_map", &reply); err != nil {
+		return nil, err
+	}
+
+	for i, b := range reply {
+		if b == nil {
+			return nil, &MalformedResponseError{Method: "d2d.memory_map", Err: fmt.Errorf("empty block %d", i)}
+		}
+	}
+
+	sort.SliceStable(reply, func(i, j int) bool {
+		return reply[i].Start < reply[j].Start
+	})
+
+	return reply, nil
 }
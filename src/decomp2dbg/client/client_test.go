@@ -0,0 +1,314 @@
+package client_test
+
+import (
+	"context"
+	"debug/elf"
+	"decompelf/src/decomp2dbg/client"
+	"decompelf/src/decomp2dbg/fakeserver"
+	"decompelf/src/decomp2dbg/xmlrpc"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func program() *fakeserver.Program {
+	return &fakeserver.Program{
+		ElfInfo: fakeserver.ElfInfo{Name: "fw", Machine: int(elf.EM_ARM), Is32Bit: true, Flags: 0x5000000, ImageBase: 0x10000},
+		Functions: []fakeserver.Function{
+			{
+				Name: "main", Address: 0x10000, Size: 24,
+				Decompilation: []string{"int main(void)", "{", "  return 0;", "}"},
+				AddrLines:     map[uint64]int{0x10000: 0, 0x10010: 2},
+				Args:          []fakeserver.Var{{Name: "argc", Type: "int", Size: 4, Reg: "r0"}},
+				StackVars:     []fakeserver.Var{{Name: "local_8", Type: "int", Size: 4, Offset: -8}},
+			},
+			{Name: "helper", Address: 0x10018, Size: 8},
+		},
+		Globals: []fakeserver.Global{{Name: "counter", Address: 0x20000, Type: "uint", Size: 4}, {Name: "label", Address: 0x20010}},
+		DataTypes: map[string]fakeserver.DataType{
+			"uint": {Kind: client.KindBase, Size: 4, Encoding: client.EncodingUnsigned},
+		},
+		MemoryBlocks: []fakeserver.MemoryBlock{{Name: ".text", Start: 0x10000, Size: 0x1000, Perms: "rx"}},
+	}
+}
+
+func newClient(t *testing.T) (*fakeserver.Server, *client.Client) {
+	s := fakeserver.New(program())
+	t.Cleanup(s.Close)
+
+	c := s.Client()
+	c.RetryBackoff = time.Millisecond
+
+	return s, c
+}
+
+func TestMethods(t *testing.T) {
+	_, c := newClient(t)
+	ctx := context.Background()
+
+	if pong, err := c.Ping(ctx); err != nil || !pong {
+		t.Errorf("ping: got %v, %v", pong, err)
+	}
+
+	info, err := c.ElfInfo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantInfo := &client.ElfInfo{Machine: elf.EM_ARM, ImageBase: 0x10000, Flags: 0x5000000, Is32Bit: true, Name: "fw"}
+	if !reflect.DeepEqual(info, wantInfo) {
+		t.Errorf("elf info: got %+v, want %+v", info, wantInfo)
+	}
+
+	fh, err := c.FunctionHeaders(ctx)
+	if err != nil || len(fh) != 2 {
+		t.Fatalf("function headers: got %v, %v", fh, err)
+	}
+
+	byName := map[string]client.FunctionHeader{}
+	for _, f := range fh {
+		byName[f.Name] = *f
+	}
+
+	if byName["main"] != (client.FunctionHeader{Name: "main", Size: 24, Value: 0x10000}) {
+		t.Errorf("function headers: got %+v", byName)
+	}
+
+	gv, err := c.GlobalVars(ctx)
+	if err != nil || len(gv) != 2 {
+		t.Fatalf("global vars: got %v, %v", gv, err)
+	}
+
+	for _, g := range gv {
+		if g.Name == "counter" && (g.Value != 0x20000 || g.Type != "uint" || g.Size != 4) {
+			t.Errorf("global vars: got %+v", g)
+		}
+	}
+
+	if base, err := c.GetImageBase(ctx); err != nil || base != 0x10000 {
+		t.Errorf("image base: got 0x%x, %v", base, err)
+	}
+
+	dec, err := c.Decompile(ctx, 0x10010)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dec.FuncName != "main" || dec.CurrLine != 2 || len(dec.Lines) != 4 || dec.AddrLines[0x10010] != 2 {
+		t.Errorf("decompile: got %+v", dec)
+	}
+
+	data, err := c.FunctionData(ctx, 0x10000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data.Args) != 1 || data.Args[0].Register != "r0" || len(data.StackVars) != 1 || !data.StackVars[0].HasOffset || data.StackVars[0].Offset != -8 {
+		t.Errorf("function data: got args %+v, stack vars %+v", data.Args, data.StackVars)
+	}
+
+	types, err := c.DataTypes(ctx)
+	if err != nil || types["uint"] == nil || types["uint"].Name != "uint" || types["uint"].Size != 4 {
+		t.Errorf("data types: got %+v, %v", types, err)
+	}
+
+	blocks, err := c.MemoryMap(ctx)
+	if err != nil || len(blocks) != 1 || blocks[0].Start != 0x10000 || !blocks[0].Execute || blocks[0].Write {
+		t.Errorf("memory map: got %+v, %v", blocks, err)
+	}
+}
+
+func TestHexToUint64(t *testing.T) {
+	tests := map[string]uint64{"0x1000": 0x1000, "0X1000": 0x1000, "1000": 0x1000, "0xffffffff80000000": 0xffffffff80000000}
+	for hex, want := range tests {
+		if got, err := client.HexToUint64(hex); err != nil || got != want {
+			t.Errorf("%s: got 0x%x, %v, want 0x%x", hex, got, err, want)
+		}
+	}
+
+	for _, bad := range []string{"", "0x", "0xzz", "0x10000000000000000"} {
+		if _, err := client.HexToUint64(bad); err == nil {
+			t.Errorf("%q: got no error", bad)
+		}
+	}
+}
+
+func TestFaultError(t *testing.T) {
+	s, c := newClient(t)
+	s.InjectFault("d2d.function_headers", 42, "program closed")
+
+	_, err := c.FunctionHeaders(context.Background())
+	var fault *client.FaultError
+	if !errors.As(err, &fault) || fault.Code != 42 || fault.String != "program closed" || fault.Method != "d2d.function_headers" {
+		t.Errorf("got %v, want fault 42", err)
+	}
+
+	if calls := s.Calls("d2d.function_headers"); calls != 1 {
+		t.Errorf("faults are not retried, got %d calls", calls)
+	}
+}
+
+func TestUnsupportedMethod(t *testing.T) {
+	s, c := newClient(t)
+	s.Program().MemoryBlocks = nil
+
+	_, err := c.MemoryMap(context.Background())
+	var fault *client.FaultError
+	if !errors.As(err, &fault) || fault.Code != fakeserver.FaultMethodNotFound {
+		t.Errorf("got %v, want method not found fault", err)
+	}
+}
+
+func TestHTTPStatusError(t *testing.T) {
+	tests := []struct {
+		status int
+		calls  int
+	}{
+		{status: http.StatusNotFound, calls: 1},
+		{status: http.StatusServiceUnavailable, calls: 3},
+		{status: http.StatusTooManyRequests, calls: 3},
+	}
+
+	for _, tt := range tests {
+		s, c := newClient(t)
+		c.Retries = 2
+		s.SetStatus("d2d.ping", tt.status)
+
+		_, err := c.Ping(context.Background())
+		var status *client.HTTPStatusError
+		if !errors.As(err, &status) || status.StatusCode != tt.status {
+			t.Errorf("%d: got %v, want http status error", tt.status, err)
+		}
+
+		if calls := s.Calls("d2d.ping"); calls != tt.calls {
+			t.Errorf("%d: got %d calls, want %d", tt.status, calls, tt.calls)
+		}
+	}
+}
+
+func TestRetryRecovers(t *testing.T) {
+	s, c := newClient(t)
+	c.Retries = 3
+
+	failures := 2
+	s.Handle("d2d.getImageBase", func([]any) (any, error) {
+		if failures > 0 {
+			failures--
+			return nil, errors.New("decompiler busy")
+		}
+
+		return "0x10000", nil
+	})
+
+	if base, err := c.GetImageBase(context.Background()); err != nil || base != 0x10000 {
+		t.Errorf("got 0x%x, %v", base, err)
+	}
+
+	if calls := s.Calls("d2d.getImageBase"); calls != 3 {
+		t.Errorf("got %d calls, want 3", calls)
+	}
+}
+
+func TestNegativeRetries(t *testing.T) {
+	s, c := newClient(t)
+	c.Retries = -1
+	s.SetStatus("d2d.ping", http.StatusServiceUnavailable)
+
+	if _, err := c.Ping(context.Background()); err == nil {
+		t.Errorf("got no error")
+	}
+
+	if calls := s.Calls("d2d.ping"); calls != 1 {
+		t.Errorf("got %d calls, want 1", calls)
+	}
+}
+
+func TestTransportError(t *testing.T) {
+	s, c := newClient(t)
+	c.Retries = 1
+	s.Close()
+
+	_, err := c.Ping(context.Background())
+	var transport *client.TransportError
+	if !errors.As(err, &transport) || transport.Method != "d2d.ping" {
+		t.Errorf("got %v, want transport error", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	s, c := newClient(t)
+	c.Timeout = 20 * time.Millisecond
+	s.SetLatency("d2d.ping", time.Second)
+
+	_, err := c.Ping(context.Background())
+	var transport *client.TransportError
+	if !errors.As(err, &transport) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want deadline exceeded", err)
+	}
+}
+
+func TestCanceledContextStopsRetries(t *testing.T) {
+	s, c := newClient(t)
+	c.Retries = 5
+	c.RetryBackoff = time.Hour
+	s.SetStatus("d2d.ping", http.StatusBadGateway)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := c.Ping(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want deadline exceeded", err)
+	}
+
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("retry backoff ignored context")
+	}
+}
+
+func TestMalformedResponseError(t *testing.T) {
+	tests := map[string]string{
+		"not xml":    "<html>oops",
+		"wrong type": `<?xml version="1.0"?><methodResponse><params><param><value><string>yes</string></value></param></params></methodResponse>`,
+	}
+
+	for name, body := range tests {
+		s, c := newClient(t)
+		s.SetMalformed("d2d.ping", []byte(body))
+
+		_, err := c.Ping(context.Background())
+		var malformed *client.MalformedResponseError
+		if !errors.As(err, &malformed) || malformed.Method != "d2d.ping" {
+			t.Errorf("%s: got %v, want malformed response error", name, err)
+		}
+
+		if name == "not xml" && !errors.Is(err, xmlrpc.ErrMalformed) {
+			t.Errorf("%s: got %v, want %v", name, err, xmlrpc.ErrMalformed)
+		}
+	}
+}
+
+func TestResponseTooLarge(t *testing.T) {
+	_, c := newClient(t)
+	c.MaxResponseSize = 16
+
+	if _, err := c.FunctionHeaders(context.Background()); !errors.Is(err, client.ErrResponseTooLarge) {
+		t.Errorf("got %v, want %v", err, client.ErrResponseTooLarge)
+	}
+}
+
+func TestUnexpectedFieldError(t *testing.T) {
+	s, c := newClient(t)
+	s.Handle("d2d.elf_info", func([]any) (any, error) {
+		return map[string]any{"name": "fw", "machine": 40, "is_32_bit": true, "is_big_endian": false,
+			"flags": "0x0", "image_base": "0x10000", "arch_variant": "v7"}, nil
+	})
+
+	_, err := c.ElfInfo(context.Background())
+	var unexpected *client.UnexpectedFieldError
+	if !errors.As(err, &unexpected) || unexpected.Field != "arch_variant" {
+		t.Errorf("got %v, want unexpected field arch_variant", err)
+	}
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"fmt"
+)
+
+// TransportError is returned when request could not be sent or response could not be read.
+type TransportError struct {
+	Method string
+	Err    error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("%s: transport error: %s", e.Method, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPStatusError is returned when server replies with non-200 status.
+type HTTPStatusError struct {
+	Method     string
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%s: unexpected http status %s", e.Method, e.Status)
+}
+
+// FaultError is an XML-RPC fault reported by decomp2dbg server.
+type FaultError struct {
+	Method string
+	Code   int
+	String string
+}
+
+func (e *FaultError) Error() string {
+	return fmt.Sprintf("%s: fault %d: %s", e.Method, e.Code, e.String)
+}
+
+// MalformedResponseError is returned when response is not a valid XML-RPC document
+// or its contents do not match expected layout.
+type MalformedResponseError struct {
+	Method string
+	Err    error
+}
+
+func (e *MalformedResponseError) Error() string {
+	return fmt.Sprintf("%s: malformed response: %s", e.Method, e.Err)
+}
+
+func (e *MalformedResponseError) Unwrap() error {
+	return e.Err
+}
+
+// UnexpectedFieldError is returned when response struct contains unknown member.
+type UnexpectedFieldError struct {
+	Method string
+	Field  string
+}
+
+func (e *UnexpectedFieldError) Error() string {
+	return fmt.Sprintf("%s: unexpected field %s", e.Method, e.Field)
+}
+
+// NotRecordedError is returned by replayed sessions for calls missing from recording, it is not retried.
+type NotRecordedError struct {
+	Method string
+}
+
+func (e *NotRecordedError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Method, ErrNotRecorded)
+}
+
+func (e *NotRecordedError) Unwrap() error {
+	return ErrNotRecorded
+}
@@ -0,0 +1,219 @@
+package client
+
+import (
+	"bytes"
+	"decompelf/src/decomp2dbg/xmlrpc"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	requestSuffix  = ".request.xml"
+	responseSuffix = ".response.xml"
+	// manifestName is session description written by RecordTransport.
+	manifestName = "manifest.json"
+)
+
+var ErrNotRecorded = errors.New("no recorded response")
+
+// manifest is stored in session directory, file times are not kept by copies and archives.
+type manifest struct {
+	Recorded time.Time `json:"recorded"`
+}
+
+// RecordTransport saves every XML-RPC request and response pair into Dir
+// as NNNN-<method>.request.xml and NNNN-<method>.response.xml, time of capture goes to manifest.json.
+// Replies with non-200 status are passed through, but not recorded.
+type RecordTransport struct {
+	Dir string
+	// Base performs requests, http.DefaultTransport if nil.
+	Base http.RoundTripper
+
+	mu  sync.Mutex
+	seq int
+}
+
+func NewRecordTransport(dir string, base http.RoundTripper) (*RecordTransport, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	existing, err := filepath.Glob(filepath.Join(dir, "*"+requestSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	// appended sessions keep time of the first capture
+	path := filepath.Join(dir, manifestName)
+	if _, err = os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		data, err := json.Marshal(manifest{Recorded: time.Now().UTC().Truncate(time.Second)})
+		if err != nil {
+			return nil, err
+		}
+
+		if err = os.WriteFile(path, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write session manifest: %w", err)
+		}
+	}
+
+	return &RecordTransport{Dir: dir, Base: base, seq: len(existing)}, nil
+}
+
+func (t *RecordTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var req []byte
+	var err error
+	if r.Body != nil {
+		req, err = io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(req))
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	method, _, err := xmlrpc.DecodeCall(req)
+	if err != nil {
+		method = "unknown"
+	}
+
+	t.mu.Lock()
+	t.seq++
+	prefix := filepath.Join(t.Dir, fmt.Sprintf("%04d-%s", t.seq, filepath.Base(method)))
+	t.mu.Unlock()
+
+	if err = os.WriteFile(prefix+requestSuffix, req, 0644); err != nil {
+		return nil, fmt.Errorf("failed to record request: %w", err)
+	}
+
+	if err = os.WriteFile(prefix+responseSuffix, body, 0644); err != nil {
+		return nil, fmt.Errorf("failed to record response: %w", err)
+	}
+
+	return resp, nil
+}
+
+// ReplayTransport serves responses recorded by RecordTransport.
+// Requests are matched by body, identical requests get recorded responses in order,
+// the last one is repeated when they run out.
+type ReplayTransport struct {
+	// Recorded is time of capture from session manifest, zero for sessions without it.
+	Recorded time.Time
+
+	mu       sync.Mutex
+	sessions map[string][][]byte
+	served   map[string]int
+}
+
+func NewReplayTransport(dir string) (*ReplayTransport, error) {
+	requests, err := filepath.Glob(filepath.Join(dir, "*"+requestSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("%w in %s", ErrNotRecorded, dir)
+	}
+
+	sort.Strings(requests)
+
+	t := &ReplayTransport{
+		sessions: map[string][][]byte{},
+		served:   map[string]int{},
+	}
+
+	for _, name := range requests {
+		req, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := os.ReadFile(strings.TrimSuffix(name, requestSuffix) + responseSuffix)
+		if err != nil {
+			return nil, err
+		}
+
+		t.sessions[string(req)] = append(t.sessions[string(req)], resp)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, err
+	default:
+		m := manifest{}
+		if err = json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("failed to parse session manifest: %w", err)
+		}
+		t.Recorded = m.Recorded
+	}
+
+	return t, nil
+}
+
+func (t *ReplayTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var req []byte
+	var err error
+	if r.Body != nil {
+		req, err = io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.mu.Lock()
+	responses := t.sessions[string(req)]
+	i := t.served[string(req)]
+	if i < len(responses)-1 {
+		t.served[string(req)]++
+	}
+	t.mu.Unlock()
+
+	if len(responses) == 0 {
+		method, _, _ := xmlrpc.DecodeCall(req)
+		return nil, fmt.Errorf("%w for %s", ErrNotRecorded, method)
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"text/xml"}},
+		Body:          io.NopCloser(bytes.NewReader(responses[i])),
+		ContentLength: int64(len(responses[i])),
+		Request:       r,
+	}, nil
+}
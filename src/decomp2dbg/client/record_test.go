@@ -0,0 +1,159 @@
+package client_test
+
+import (
+	"context"
+	"decompelf/src/decomp2dbg/client"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// record saves ping and elf info session into dir.
+func record(t *testing.T, dir string) {
+	s, c := newClient(t)
+	rt, err := client.NewRecordTransport(dir, s.Server.Client().Transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.HTTPClient = &http.Client{Transport: rt}
+
+	ctx := context.Background()
+	if _, err = c.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = c.ElfInfo(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func replay(t *testing.T, dir string) (*client.ReplayTransport, *client.Client) {
+	rt, err := client.NewReplayTransport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rt, &client.Client{URL: "http://replay/RPC2", HTTPClient: &http.Client{Transport: rt}}
+}
+
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	before := time.Now().Truncate(time.Second)
+	record(t, dir)
+
+	// file times are not part of session
+	old := time.Unix(1000000000, 0)
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	for _, name := range files {
+		if err := os.Chtimes(name, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rt, c := replay(t, dir)
+	if rt.Recorded.Before(before) || rt.Recorded.After(time.Now()) {
+		t.Errorf("recorded: got %s, want time of recording", rt.Recorded)
+	}
+
+	info, err := c.ElfInfo(context.Background())
+	if err != nil || info.Name != "fw" {
+		t.Errorf("got %+v, %v", info, err)
+	}
+
+	// appending to session keeps the first time
+	recorded := rt.Recorded
+	record(t, dir)
+	if rt, _ = replay(t, dir); !rt.Recorded.Equal(recorded) {
+		t.Errorf("recorded after append: got %s, want %s", rt.Recorded, recorded)
+	}
+}
+
+func TestReplayWithoutManifest(t *testing.T) {
+	dir := t.TempDir()
+	record(t, dir)
+	if err := os.Remove(filepath.Join(dir, "manifest.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	if rt, _ := replay(t, dir); !rt.Recorded.IsZero() {
+		t.Errorf("recorded: got %s, want zero", rt.Recorded)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.NewReplayTransport(dir); err == nil {
+		t.Errorf("malformed manifest is accepted")
+	}
+}
+
+func TestReplayMiss(t *testing.T) {
+	dir := t.TempDir()
+	record(t, dir)
+
+	_, c := replay(t, dir)
+	c.Retries = 5
+	c.RetryBackoff = time.Hour
+
+	var notRecorded *client.NotRecordedError
+	_, err := c.FunctionHeaders(context.Background())
+	if !errors.As(err, &notRecorded) || !errors.Is(err, client.ErrNotRecorded) || notRecorded.Method != "d2d.function_headers" {
+		t.Errorf("got %v, want %v", err, client.ErrNotRecorded)
+	}
+
+	var transport *client.TransportError
+	if errors.As(err, &transport) {
+		t.Errorf("miss is a transport error: %v", err)
+	}
+}
+
+func TestReplayOrder(t *testing.T) {
+	dir := t.TempDir()
+	s, c := newClient(t)
+	rt, err := client.NewRecordTransport(dir, s.Server.Client().Transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.HTTPClient = &http.Client{Transport: rt}
+
+	bases := []string{"0x10000", "0x20000"}
+	s.Handle("d2d.getImageBase", func([]any) (any, error) {
+		base := bases[0]
+		bases = bases[1:]
+		return base, nil
+	})
+
+	ctx := context.Background()
+	for range []int{0, 1} {
+		if _, err = c.GetImageBase(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// failed replies are not recorded
+	s.SetStatus("d2d.ping", http.StatusServiceUnavailable)
+	c.Retries = 0
+	if _, err = c.Ping(ctx); err == nil {
+		t.Fatal("got no error")
+	}
+
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.xml")); len(files) != 4 {
+		t.Errorf("got recorded files %v", files)
+	}
+
+	// identical requests get responses in order, the last one is repeated
+	_, c = replay(t, dir)
+	for _, want := range []uint64{0x10000, 0x20000, 0x20000} {
+		if base, err := c.GetImageBase(ctx); err != nil || base != want {
+			t.Errorf("got 0x%x, %v, want 0x%x", base, err, want)
+		}
+	}
+
+	if _, err = client.NewReplayTransport(t.TempDir()); !errors.Is(err, client.ErrNotRecorded) {
+		t.Errorf("empty session: got %v, want %v", err, client.ErrNotRecorded)
+	}
+}
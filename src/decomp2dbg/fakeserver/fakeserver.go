@@ -0,0 +1,486 @@
+// Package fakeserver is an in-process decomp2dbg server for tests.
+package fakeserver
+
+import (
+	"context"
+	"decompelf/src/decomp2dbg/client"
+	"decompelf/src/decomp2dbg/xmlrpc"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FaultMethodNotFound is returned for unknown methods, same as python xmlrpc.server.
+const FaultMethodNotFound = 1
+
+type ElfInfo struct {
+	Name        string `json:"name"`
+	Machine     int    `json:"machine"`
+	Is32Bit     bool   `json:"is_32_bit"`
+	IsBigEndian bool   `json:"is_big_endian"`
+	Flags       uint64 `json:"flags"`
+	ImageBase   uint64 `json:"image_base"`
+}
+
+type Function struct {
+	Name          string   `json:"name"`
+	Address       uint64   `json:"address"`
+	Size          uint64   `json:"size"`
+	Decompilation []string `json:"decompilation,omitempty"`
+	// AddrLines maps instruction addresses to 0-based Decompilation lines.
+	AddrLines map[uint64]int `json:"addr_lines,omitempty"`
+	Args      []Var          `json:"args,omitempty"`
+	StackVars []Var          `json:"stack_vars,omitempty"`
+	RegVars   []Var          `json:"reg_vars,omitempty"`
+}
+
+// Var is a function argument or variable, stack variables use Offset, register ones use Reg.
+type Var struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Size   uint64 `json:"size"`
+	Offset int64  `json:"offset,omitempty"`
+	Reg    string `json:"reg,omitempty"`
+}
+
+type Global struct {
+	Name    string `json:"name"`
+	Address uint64 `json:"address"`
+	Type    string `json:"type,omitempty"`
+	Size    uint64 `json:"size,omitempty"`
+}
+
+type Member struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Offset uint64 `json:"offset"`
+}
+
+type Enumerator struct {
+	Name  string `json:"name"`
+	Value int64  `json:"value"`
+}
+
+// DataType is a named data type, Kind and Encoding values are the same as in client package.
+type DataType struct {
+	Kind        string       `json:"kind"`
+	Size        uint64       `json:"size,omitempty"`
+	Encoding    string       `json:"encoding,omitempty"`
+	Target      string       `json:"target,omitempty"`
+	Count       uint64       `json:"count,omitempty"`
+	Members     []Member     `json:"members,omitempty"`
+	Enumerators []Enumerator `json:"enumerators,omitempty"`
+}
+
+// MemoryBlock is a memory block, Perms is a subset of "rwx".
+type MemoryBlock struct {
+	Name  string `json:"name"`
+	Start uint64 `json:"start"`
+	Size  uint64 `json:"size"`
+	Perms string `json:"perms"`
+}
+
+// Program is an in-memory model of a program opened in decompiler.
+// d2d.memory_map is not supported if MemoryBlocks is nil, same as older decomp2dbg versions.
+type Program struct {
+	ElfInfo      ElfInfo             `json:"elf_info"`
+	Functions    []Function          `json:"functions"`
+	Globals      []Global            `json:"globals"`
+	DataTypes    map[string]DataType `json:"data_types,omitempty"`
+	MemoryBlocks []MemoryBlock       `json:"memory_blocks,omitempty"`
+}
+
+func LoadFixture(path string) (*Program, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Program{}
+	if err = json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+
+	return p, nil
+}
+
+// HandlerFunc returns XML-RPC result for method params. Returning *xmlrpc.Fault produces a fault response.
+type HandlerFunc func(params []any) (any, error)
+
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	program   *Program
+	handlers  map[string]HandlerFunc
+	faults    map[string]*xmlrpc.Fault
+	latency   map[string]time.Duration
+	malformed map[string][]byte
+	status    map[string]int
+	calls     map[string]int
+}
+
+// New starts a server serving p. Call Close when done.
+func New(p *Program) *Server {
+	s := &Server{
+		program:   p,
+		handlers:  map[string]HandlerFunc{},
+		faults:    map[string]*xmlrpc.Fault{},
+		latency:   map[string]time.Duration{},
+		malformed: map[string][]byte{},
+		status:    map[string]int{},
+		calls:     map[string]int{},
+	}
+
+	s.handlers["d2d.ping"] = s.ping
+	s.handlers["d2d.elf_info"] = s.elfInfo
+	s.handlers["d2d.function_headers"] = s.functionHeaders
+	s.handlers["d2d.global_vars"] = s.globalVars
+	s.handlers["d2d.getImageBase"] = s.imageBase
+	s.handlers["d2d.decompile"] = s.decompile
+	s.handlers["d2d.function_data"] = s.functionData
+	s.handlers["d2d.data_types"] = s.dataTypes
+	s.handlers["d2d.memory_map"] = s.memoryMap
+
+	s.Server = httptest.NewServer(s)
+
+	return s
+}
+
+// Client returns decomp2dbg client connected to this server.
+func (s *Server) Client() *client.Client {
+	return &client.Client{URL: s.URL + "/RPC2", HTTPClient: s.Server.Client()}
+}
+
+// Handle registers or replaces handler for method.
+func (s *Server) Handle(method string, h HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[method] = h
+}
+
+// InjectFault makes method reply with XML-RPC fault.
+func (s *Server) InjectFault(method string, code int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[method] = &xmlrpc.Fault{Code: code, String: message}
+}
+
+// SetLatency delays replies to method, empty method delays all replies.
+func (s *Server) SetLatency(method string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency[method] = d
+}
+
+// SetMalformed makes method reply with body as is.
+func (s *Server) SetMalformed(method string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.malformed[method] = body
+}
+
+// SetStatus makes method reply with HTTP status code.
+func (s *Server) SetStatus(method string, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status[method] = code
+}
+
+// Reset removes injected faults, latency, statuses and malformed replies.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = map[string]*xmlrpc.Fault{}
+	s.latency = map[string]time.Duration{}
+	s.malformed = map[string][]byte{}
+	s.status = map[string]int{}
+}
+
+// Calls returns number of received calls to method.
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+// Program returns served program, callers may modify it between calls.
+func (s *Server) Program() *Program {
+	return s.program
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	method, params, err := xmlrpc.DecodeCall(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.calls[method]++
+	delay := s.latency[""] + s.latency[method]
+	status := s.status[method]
+	malformed, isMalformed := s.malformed[method]
+	fault := s.faults[method]
+	h, ok := s.handlers[method]
+	s.mu.Unlock()
+
+	if delay > 0 {
+		if !sleep(r.Context(), delay) {
+			return
+		}
+	}
+
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+
+	if isMalformed {
+		_, _ = w.Write(malformed)
+		return
+	}
+
+	if fault == nil && !ok {
+		fault = &xmlrpc.Fault{Code: FaultMethodNotFound, String: fmt.Sprintf("method %q is not supported", method)}
+	}
+
+	var reply []byte
+	if fault == nil {
+		var result any
+		result, err = h(params)
+		if err != nil {
+			if !errors.As(err, &fault) {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			reply, err = xmlrpc.EncodeResponse(result)
+		}
+	}
+
+	if fault != nil {
+		reply, err = xmlrpc.EncodeFault(fault.Code, fault.String)
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, _ = w.Write(reply)
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (s *Server) ping([]any) (any, error) {
+	return true, nil
+}
+
+func (s *Server) elfInfo([]any) (any, error) {
+	info := s.program.ElfInfo
+	return map[string]any{
+		"name":          info.Name,
+		"machine":       info.Machine,
+		"is_32_bit":     info.Is32Bit,
+		"is_big_endian": info.IsBigEndian,
+		"flags":         hex(info.Flags),
+		"image_base":    hex(info.ImageBase),
+	}, nil
+}
+
+func (s *Server) functionHeaders([]any) (any, error) {
+	result := map[string]any{}
+	for _, f := range s.program.Functions {
+		result[hex(f.Address)] = map[string]any{"name": f.Name, "size": f.Size}
+	}
+
+	return result, nil
+}
+
+func (s *Server) globalVars([]any) (any, error) {
+	result := map[string]any{}
+	for _, g := range s.program.Globals {
+		m := map[string]any{"name": g.Name}
+		if g.Type != "" {
+			m["type"] = g.Type
+			m["size"] = g.Size
+		}
+		result[hex(g.Address)] = m
+	}
+
+	return result, nil
+}
+
+func (s *Server) imageBase([]any) (any, error) {
+	return hex(s.program.ElfInfo.ImageBase), nil
+}
+
+// function returns function containing address passed as the only param.
+func (s *Server) function(params []any) (*Function, uint64, error) {
+	if len(params) != 1 {
+		return nil, 0, &xmlrpc.Fault{Code: 2, String: "expected 1 param"}
+	}
+
+	a, ok := params[0].(int64)
+	if !ok {
+		return nil, 0, &xmlrpc.Fault{Code: 2, String: fmt.Sprintf("bad address %v", params[0])}
+	}
+	addr := uint64(a)
+
+	for i, f := range s.program.Functions {
+		if addr == f.Address || (addr > f.Address && addr < f.Address+f.Size) {
+			return &s.program.Functions[i], addr, nil
+		}
+	}
+
+	return nil, 0, &xmlrpc.Fault{Code: 3, String: fmt.Sprintf("no function at %s", hex(addr))}
+}
+
+func (s *Server) decompile(params []any) (any, error) {
+	f, addr, err := s.function(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Decompilation == nil {
+		return nil, &xmlrpc.Fault{Code: 3, String: fmt.Sprintf("no decompilation for %s", f.Name)}
+	}
+
+	addrLines := map[string]any{}
+	currLine := -1
+	for fa, line := range f.AddrLines {
+		addrLines[hex(fa)] = line
+		if fa == addr {
+			currLine = line
+		}
+	}
+
+	return map[string]any{
+		"decompilation": f.Decompilation,
+		"curr_line":     currLine,
+		"func_name":     f.Name,
+		"addr_lines":    addrLines,
+	}, nil
+}
+
+func (s *Server) functionData(params []any) (any, error) {
+	f, _, err := s.function(params)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := func(list []Var, key func(i int, v Var) string) map[string]any {
+		result := map[string]any{}
+		for i, v := range list {
+			m := map[string]any{"name": v.Name, "type": v.Type, "size": v.Size}
+			if v.Reg != "" {
+				m["reg"] = v.Reg
+			} else {
+				m["offset"] = v.Offset
+			}
+			result[key(i, v)] = m
+		}
+
+		return result
+	}
+
+	return map[string]any{
+		"args": vars(f.Args, func(i int, _ Var) string {
+			return hex(uint64(i))
+		}),
+		"stack_vars": vars(f.StackVars, func(_ int, v Var) string {
+			return fmt.Sprintf("%d", v.Offset)
+		}),
+		"reg_vars": vars(f.RegVars, func(_ int, v Var) string {
+			return v.Reg
+		}),
+	}, nil
+}
+
+func (s *Server) dataTypes([]any) (any, error) {
+	result := map[string]any{}
+	for name, t := range s.program.DataTypes {
+		m := map[string]any{"kind": t.Kind, "size": t.Size}
+		if t.Encoding != "" {
+			m["encoding"] = t.Encoding
+		}
+		if t.Target != "" {
+			m["target"] = t.Target
+		}
+		if t.Count != 0 {
+			m["count"] = t.Count
+		}
+		if len(t.Members) > 0 {
+			members := []any{}
+			for _, member := range t.Members {
+				members = append(members, map[string]any{"name": member.Name, "type": member.Type, "offset": member.Offset})
+			}
+			m["members"] = members
+		}
+		if len(t.Enumerators) > 0 {
+			enumerators := []any{}
+			for _, e := range t.Enumerators {
+				enumerators = append(enumerators, map[string]any{"name": e.Name, "value": e.Value})
+			}
+			m["enumerators"] = enumerators
+		}
+		result[name] = m
+	}
+
+	return result, nil
+}
+
+func (s *Server) memoryMap([]any) (any, error) {
+	if s.program.MemoryBlocks == nil {
+		return nil, &xmlrpc.Fault{Code: FaultMethodNotFound, String: `method "d2d.memory_map" is not supported`}
+	}
+
+	result := []any{}
+	for _, b := range s.program.MemoryBlocks {
+		result = append(result, map[string]any{
+			"name":    b.Name,
+			"start":   hex(b.Start),
+			"size":    b.Size,
+			"read":    strings.Contains(b.Perms, "r"),
+			"write":   strings.Contains(b.Perms, "w"),
+			"execute": strings.Contains(b.Perms, "x"),
+		})
+	}
+
+	return result, nil
+}
+
+func hex(v uint64) string {
+	return fmt.Sprintf("0x%x", v)
+}
@@ -0,0 +1,301 @@
+package xmlrpc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnsupported = errors.New("unsupported xml-rpc type")
+
+type TypeError struct {
+	Value  any
+	Target reflect.Type
+	Path   string
+}
+
+func (e *TypeError) Error() string {
+	return fmt.Sprintf("cannot decode %T into %s at %q", e.Value, e.Target, e.Path)
+}
+
+type UnknownFieldError struct {
+	Field string
+	Path  string
+}
+
+func (e *UnknownFieldError) Error() string {
+	return fmt.Sprintf("unexpected field %q at %q", e.Field, e.Path)
+}
+
+// Unmarshal stores decoded value v into out, which must be a non-nil pointer.
+// Struct fields are matched by `xmlrpc:"name"` tag or field name, unknown struct members are ignored.
+// The `hex` tag option allows integer fields to be sent as hex strings, e.g. "0x10000".
+func Unmarshal(v any, out any) error {
+	return unmarshal(v, out, false)
+}
+
+// UnmarshalStrict is like Unmarshal, but returns *UnknownFieldError for struct members without a matching field.
+func UnmarshalStrict(v any, out any) error {
+	return unmarshal(v, out, true)
+}
+
+func unmarshal(v any, out any, strict bool) error {
+	rv := reflect.ValueOf(out)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("%w: out must be a non-nil pointer, got %T", ErrUnsupported, out)
+	}
+
+	u := &unmarshaler{strict: strict}
+
+	return u.value(v, rv.Elem(), "", false)
+}
+
+type unmarshaler struct {
+	strict bool
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (u *unmarshaler) value(v any, out reflect.Value, path string, hex bool) error {
+	if v == nil {
+		out.SetZero()
+		return nil
+	}
+
+	if out.Kind() == reflect.Pointer {
+		if out.IsNil() {
+			out.Set(reflect.New(out.Type().Elem()))
+		}
+
+		return u.value(v, out.Elem(), path, hex)
+	}
+
+	if out.Kind() == reflect.Interface && out.NumMethod() == 0 {
+		out.Set(reflect.ValueOf(v))
+		return nil
+	}
+
+	mismatch := &TypeError{Value: v, Target: out.Type(), Path: path}
+
+	if out.Type() == timeType {
+		t, ok := v.(time.Time)
+		if !ok {
+			return mismatch
+		}
+		out.Set(reflect.ValueOf(t))
+
+		return nil
+	}
+
+	switch out.Kind() {
+	case reflect.Bool:
+		switch b := v.(type) {
+		case bool:
+			out.SetBool(b)
+		case int64:
+			out.SetBool(b != 0)
+		default:
+			return mismatch
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := toInt(v, hex)
+		if err != nil || out.OverflowInt(i) {
+			return mismatch
+		}
+		out.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, err := toUint(v, hex)
+		if err != nil || out.OverflowUint(i) {
+			return mismatch
+		}
+		out.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		switch f := v.(type) {
+		case float64:
+			out.SetFloat(f)
+		case int64:
+			out.SetFloat(float64(f))
+		default:
+			return mismatch
+		}
+	case reflect.String:
+		s, ok := v.(string)
+		if !ok {
+			return mismatch
+		}
+		out.SetString(s)
+	case reflect.Slice:
+		if out.Type().Elem().Kind() == reflect.Uint8 {
+			switch b := v.(type) {
+			case []byte:
+				out.SetBytes(b)
+			case string:
+				out.SetBytes([]byte(b))
+			default:
+				return mismatch
+			}
+
+			return nil
+		}
+
+		a, ok := v.([]any)
+		if !ok {
+			return mismatch
+		}
+
+		s := reflect.MakeSlice(out.Type(), len(a), len(a))
+		for i, e := range a {
+			if err := u.value(e, s.Index(i), path+"["+strconv.Itoa(i)+"]", hex); err != nil {
+				return err
+			}
+		}
+		out.Set(s)
+	case reflect.Map:
+		m, ok := v.(map[string]any)
+		if !ok || out.Type().Key().Kind() != reflect.String {
+			return mismatch
+		}
+
+		res := reflect.MakeMapWithSize(out.Type(), len(m))
+		for k, e := range m {
+			ev := reflect.New(out.Type().Elem()).Elem()
+			if err := u.value(e, ev, path+"."+k, hex); err != nil {
+				return err
+			}
+			res.SetMapIndex(reflect.ValueOf(k).Convert(out.Type().Key()), ev)
+		}
+		out.Set(res)
+	case reflect.Struct:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return mismatch
+		}
+
+		fields := structFields(out.Type())
+		for k, e := range m {
+			f, ok := fields.byName(k)
+			if !ok {
+				if u.strict {
+					return &UnknownFieldError{Field: k, Path: path}
+				}
+				continue
+			}
+
+			if err := u.value(e, out.FieldByIndex(f.index), path+"."+k, f.hex); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupported, out.Type())
+	}
+
+	return nil
+}
+
+func toInt(v any, hex bool) (int64, error) {
+	switch i := v.(type) {
+	case int64:
+		return i, nil
+	case string:
+		if hex {
+			u, err := parseHex(i)
+			if err == nil && u > math.MaxInt64 {
+				return 0, fmt.Errorf("%s: %w", i, strconv.ErrRange)
+			}
+
+			return int64(u), err
+		}
+	}
+
+	return 0, ErrUnsupported
+}
+
+func toUint(v any, hex bool) (uint64, error) {
+	switch i := v.(type) {
+	case int64:
+		if i < 0 {
+			return 0, ErrUnsupported
+		}
+		return uint64(i), nil
+	case string:
+		if hex {
+			return parseHex(i)
+		}
+	}
+
+	return 0, ErrUnsupported
+}
+
+func parseHex(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	s, _ = strings.CutPrefix(s, "0x")
+	s, _ = strings.CutPrefix(s, "0X")
+
+	return strconv.ParseUint(s, 16, 64)
+}
+
+type field struct {
+	name      string
+	index     []int
+	hex       bool
+	omitEmpty bool
+}
+
+type fieldList []field
+
+func (l fieldList) byName(name string) (field, bool) {
+	for _, f := range l {
+		if f.name == name {
+			return f, true
+		}
+	}
+
+	return field{}, false
+}
+
+var fieldCache sync.Map
+
+func structFields(t reflect.Type) fieldList {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.(fieldList)
+	}
+
+	fields := fieldList{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		tag := sf.Tag.Get("xmlrpc")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = sf.Name
+		}
+
+		f := field{name: name, index: sf.Index}
+		for _, o := range strings.Split(opts, ",") {
+			switch o {
+			case "hex":
+				f.hex = true
+			case "omitempty":
+				f.omitEmpty = true
+			}
+		}
+
+		fields = append(fields, f)
+	}
+
+	fieldCache.Store(t, fields)
+
+	return fields
+}
@@ -0,0 +1,590 @@
+package xmlrpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Decoded values are represented with these Go types:
+//
+//	<struct>           map[string]any
+//	<array>            []any
+//	<int>, <i4>, <i8>  int64
+//	<boolean>          bool
+//	<string>           string
+//	<double>           float64
+//	<base64>           []byte
+//	<dateTime.iso8601> time.Time
+//	<nil/>             nil
+
+const iso8601 = "20060102T15:04:05"
+
+var ErrMalformed = errors.New("malformed xml-rpc document")
+
+type Fault struct {
+	Code   int    `xmlrpc:"faultCode"`
+	String string `xmlrpc:"faultString"`
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("xml-rpc fault %d: %s", f.Code, f.String)
+}
+
+func EncodeCall(method string, params ...any) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString("<?xml version=\"1.0\"?><methodCall><methodName>")
+	if err := xml.EscapeText(buf, []byte(method)); err != nil {
+		return nil, err
+	}
+
+	buf.WriteString("</methodName><params>")
+	for _, p := range params {
+		buf.WriteString("<param>")
+		if err := encodeValue(buf, reflect.ValueOf(p)); err != nil {
+			return nil, err
+		}
+		buf.WriteString("</param>")
+	}
+	buf.WriteString("</params></methodCall>")
+
+	return buf.Bytes(), nil
+}
+
+func EncodeResponse(v any) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString("<?xml version=\"1.0\"?><methodResponse><params><param>")
+	if err := encodeValue(buf, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	buf.WriteString("</param></params></methodResponse>")
+
+	return buf.Bytes(), nil
+}
+
+func EncodeFault(code int, message string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString("<?xml version=\"1.0\"?><methodResponse><fault>")
+	err := encodeValue(buf, reflect.ValueOf(map[string]any{"faultCode": code, "faultString": message}))
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString("</fault></methodResponse>")
+
+	return buf.Bytes(), nil
+}
+
+func encodeValue(buf *bytes.Buffer, v reflect.Value) error {
+	buf.WriteString("<value>")
+	defer buf.WriteString("</value>")
+
+	for v.IsValid() && (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			buf.WriteString("<nil/>")
+			return nil
+		}
+
+		v = v.Elem()
+	}
+
+	if !v.IsValid() {
+		buf.WriteString("<nil/>")
+		return nil
+	}
+
+	if t, ok := v.Interface().(time.Time); ok {
+		buf.WriteString("<dateTime.iso8601>" + t.Format(iso8601) + "</dateTime.iso8601>")
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteString("<boolean>1</boolean>")
+		} else {
+			buf.WriteString("<boolean>0</boolean>")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		encodeInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		if u > math.MaxInt64 {
+			return fmt.Errorf("%w: %d overflows i8", ErrUnsupported, u)
+		}
+		encodeInt(buf, int64(u))
+	case reflect.Float32, reflect.Float64:
+		buf.WriteString("<double>" + strconv.FormatFloat(v.Float(), 'g', -1, 64) + "</double>")
+	case reflect.String:
+		buf.WriteString("<string>")
+		if err := xml.EscapeText(buf, []byte(v.String())); err != nil {
+			return err
+		}
+		buf.WriteString("</string>")
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			buf.WriteString("<base64>" + base64.StdEncoding.EncodeToString(b) + "</base64>")
+			return nil
+		}
+
+		buf.WriteString("<array><data>")
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeValue(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("</data></array>")
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("%w: map key %s", ErrUnsupported, v.Type().Key())
+		}
+
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+
+		buf.WriteString("<struct>")
+		for _, k := range keys {
+			if err := encodeMember(buf, k, v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key()))); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("</struct>")
+	case reflect.Struct:
+		buf.WriteString("<struct>")
+		for _, f := range structFields(v.Type()) {
+			fv := v.FieldByIndex(f.index)
+			if f.omitEmpty && fv.IsZero() {
+				continue
+			}
+
+			if f.hex {
+				switch fv.Kind() {
+				case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+					fv = reflect.ValueOf(fmt.Sprintf("0x%x", fv.Int()))
+				case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+					fv = reflect.ValueOf(fmt.Sprintf("0x%x", fv.Uint()))
+				}
+			}
+
+			if err := encodeMember(buf, f.name, fv); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("</struct>")
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupported, v.Type())
+	}
+
+	return nil
+}
+
+func encodeInt(buf *bytes.Buffer, i int64) {
+	if i < math.MinInt32 || i > math.MaxInt32 {
+		buf.WriteString("<i8>" + strconv.FormatInt(i, 10) + "</i8>")
+		return
+	}
+
+	buf.WriteString("<int>" + strconv.FormatInt(i, 10) + "</int>")
+}
+
+func encodeMember(buf *bytes.Buffer, name string, v reflect.Value) error {
+	buf.WriteString("<member><name>")
+	if err := xml.EscapeText(buf, []byte(name)); err != nil {
+		return err
+	}
+	buf.WriteString("</name>")
+	if err := encodeValue(buf, v); err != nil {
+		return err
+	}
+	buf.WriteString("</member>")
+
+	return nil
+}
+
+// DecodeCall parses a methodCall document, used by servers.
+func DecodeCall(data []byte) (method string, params []any, err error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	if _, err = expectStart(d, "methodCall"); err != nil {
+		return "", nil, err
+	}
+
+	for {
+		t, err := nextElement(d)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if t == nil {
+			return method, params, nil
+		}
+
+		switch t.Name.Local {
+		case "methodName":
+			method, err = readText(d)
+			if err != nil {
+				return "", nil, err
+			}
+			method = strings.TrimSpace(method)
+		case "params":
+			params, err = decodeParams(d)
+			if err != nil {
+				return "", nil, err
+			}
+		default:
+			return "", nil, malformed("unexpected element <%s> in methodCall", t.Name.Local)
+		}
+	}
+}
+
+// DecodeResponse parses a methodResponse document. A <fault> is returned as *Fault error.
+func DecodeResponse(data []byte) (any, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	if _, err := expectStart(d, "methodResponse"); err != nil {
+		return nil, err
+	}
+
+	t, err := nextElement(d)
+	if err != nil {
+		return nil, err
+	}
+
+	if t == nil {
+		return nil, malformed("empty methodResponse")
+	}
+
+	switch t.Name.Local {
+	case "params":
+		params, err := decodeParams(d)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(params) != 1 {
+			return nil, malformed("methodResponse has %d params, expected 1", len(params))
+		}
+
+		return params[0], nil
+	case "fault":
+		if _, err = expectStart(d, "value"); err != nil {
+			return nil, err
+		}
+
+		v, err := decodeValue(d)
+		if err != nil {
+			return nil, err
+		}
+
+		fault := &Fault{}
+		if err = Unmarshal(v, fault); err != nil {
+			return nil, malformed("bad fault value: %s", err)
+		}
+
+		return nil, fault
+	default:
+		return nil, malformed("unexpected element <%s> in methodResponse", t.Name.Local)
+	}
+}
+
+func decodeParams(d *xml.Decoder) ([]any, error) {
+	params := []any{}
+	for {
+		t, err := nextElement(d)
+		if err != nil {
+			return nil, err
+		}
+
+		if t == nil {
+			return params, nil
+		}
+
+		if t.Name.Local != "param" {
+			return nil, malformed("unexpected element <%s> in params", t.Name.Local)
+		}
+
+		if _, err = expectStart(d, "value"); err != nil {
+			return nil, err
+		}
+
+		v, err := decodeValue(d)
+		if err != nil {
+			return nil, err
+		}
+
+		params = append(params, v)
+
+		if err = expectEnd(d); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// decodeValue reads the contents of <value> up to and including its end element.
+func decodeValue(d *xml.Decoder) (any, error) {
+	text := ""
+	var result any
+	typed := false
+
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, malformed("%s", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.CharData:
+			text += string(t)
+		case xml.StartElement:
+			if typed {
+				return nil, malformed("value contains more than one element")
+			}
+
+			typed = true
+			result, err = decodeTyped(d, t)
+			if err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			if !typed {
+				return text, nil
+			}
+
+			return result, nil
+		}
+	}
+}
+
+func decodeTyped(d *xml.Decoder, start xml.StartElement) (any, error) {
+	switch start.Name.Local {
+	case "struct":
+		return decodeStruct(d)
+	case "array":
+		return decodeArray(d)
+	case "nil":
+		return nil, d.Skip()
+	}
+
+	text, err := readText(d)
+	if err != nil {
+		return nil, err
+	}
+
+	switch start.Name.Local {
+	case "int", "i4", "i8":
+		i, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		if err != nil {
+			return nil, malformed("bad <%s> %q", start.Name.Local, text)
+		}
+
+		return i, nil
+	case "boolean":
+		switch strings.TrimSpace(text) {
+		case "1", "true":
+			return true, nil
+		case "0", "false":
+			return false, nil
+		}
+
+		return nil, malformed("bad <boolean> %q", text)
+	case "string":
+		return text, nil
+	case "double":
+		f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, malformed("bad <double> %q", text)
+		}
+
+		return f, nil
+	case "base64":
+		b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+		if err != nil {
+			return nil, malformed("bad <base64>: %s", err)
+		}
+
+		return b, nil
+	case "dateTime.iso8601":
+		tm, err := time.Parse(iso8601, strings.TrimSpace(text))
+		if err != nil {
+			return nil, malformed("bad <dateTime.iso8601> %q", text)
+		}
+
+		return tm, nil
+	}
+
+	return nil, malformed("unknown value type <%s>", start.Name.Local)
+}
+
+func decodeStruct(d *xml.Decoder) (map[string]any, error) {
+	result := map[string]any{}
+	for {
+		t, err := nextElement(d)
+		if err != nil {
+			return nil, err
+		}
+
+		if t == nil {
+			return result, nil
+		}
+
+		if t.Name.Local != "member" {
+			return nil, malformed("unexpected element <%s> in struct", t.Name.Local)
+		}
+
+		var name string
+		var value any
+		hasName, hasValue := false, false
+		for {
+			m, err := nextElement(d)
+			if err != nil {
+				return nil, err
+			}
+
+			if m == nil {
+				break
+			}
+
+			switch m.Name.Local {
+			case "name":
+				if name, err = readText(d); err != nil {
+					return nil, err
+				}
+				hasName = true
+			case "value":
+				if value, err = decodeValue(d); err != nil {
+					return nil, err
+				}
+				hasValue = true
+			default:
+				return nil, malformed("unexpected element <%s> in member", m.Name.Local)
+			}
+		}
+
+		if !hasName || !hasValue {
+			return nil, malformed("struct member without name or value")
+		}
+
+		result[name] = value
+	}
+}
+
+func decodeArray(d *xml.Decoder) ([]any, error) {
+	if _, err := expectStart(d, "data"); err != nil {
+		return nil, err
+	}
+
+	result := []any{}
+	for {
+		t, err := nextElement(d)
+		if err != nil {
+			return nil, err
+		}
+
+		if t == nil {
+			break
+		}
+
+		if t.Name.Local != "value" {
+			return nil, malformed("unexpected element <%s> in array", t.Name.Local)
+		}
+
+		v, err := decodeValue(d)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, v)
+	}
+
+	return result, expectEnd(d)
+}
+
+// nextElement returns the next child start element, or nil when the parent element ends.
+func nextElement(d *xml.Decoder) (*xml.StartElement, error) {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, malformed("%s", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return &t, nil
+		case xml.EndElement:
+			return nil, nil
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) != 0 {
+				return nil, malformed("unexpected text %q", string(t))
+			}
+		}
+	}
+}
+
+func expectStart(d *xml.Decoder, name string) (*xml.StartElement, error) {
+	t, err := nextElement(d)
+	if err != nil {
+		return nil, err
+	}
+
+	if t == nil {
+		return nil, malformed("expected <%s>", name)
+	}
+
+	if t.Name.Local != name {
+		return nil, malformed("expected <%s>, got <%s>", name, t.Name.Local)
+	}
+
+	return t, nil
+}
+
+func expectEnd(d *xml.Decoder) error {
+	t, err := nextElement(d)
+	if err != nil {
+		return err
+	}
+
+	if t != nil {
+		return malformed("unexpected element <%s>", t.Name.Local)
+	}
+
+	return nil
+}
+
+func readText(d *xml.Decoder) (string, error) {
+	text := ""
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return "", malformed("unexpected end of document")
+			}
+			return "", malformed("%s", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.CharData:
+			text += string(t)
+		case xml.StartElement:
+			return "", malformed("unexpected element <%s>", t.Name.Local)
+		case xml.EndElement:
+			return text, nil
+		}
+	}
+}
+
+func malformed(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrMalformed, fmt.Sprintf(format, args...))
+}
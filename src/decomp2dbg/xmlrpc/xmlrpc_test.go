@@ -0,0 +1,163 @@
+package xmlrpc
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCallRoundTrip(t *testing.T) {
+	when := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	data, err := EncodeCall("d2d.decompile", 0x10000, "a<b>&c", true, 1.5, []byte{1, 2, 3}, when, nil,
+		[]any{int64(1), "x"}, map[string]any{"k": int64(1 << 40)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	method, params, err := DecodeCall(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []any{int64(0x10000), "a<b>&c", true, 1.5, []byte{1, 2, 3}, when, nil,
+		[]any{int64(1), "x"}, map[string]any{"k": int64(1 << 40)}}
+	if method != "d2d.decompile" || !reflect.DeepEqual(params, want) {
+		t.Errorf("got %s %#v, want d2d.decompile %#v", method, params, want)
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	type reply struct {
+		Name  string `xmlrpc:"name"`
+		Base  uint64 `xmlrpc:"image_base,hex"`
+		Empty string `xmlrpc:"empty,omitempty"`
+	}
+
+	data, err := EncodeResponse(reply{Name: "fw", Base: 0x8000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := DecodeResponse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{"name": "fw", "image_base": "0x8000"}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("got %#v, want %#v", v, want)
+	}
+
+	got := reply{}
+	if err = Unmarshal(v, &got); err != nil || got != (reply{Name: "fw", Base: 0x8000}) {
+		t.Errorf("got %+v, %v", got, err)
+	}
+}
+
+func TestUntypedValueIsString(t *testing.T) {
+	v, err := DecodeResponse([]byte(`<methodResponse><params><param><value> text </value></param></params></methodResponse>`))
+	if err != nil || v != " text " {
+		t.Errorf("got %#v, %v", v, err)
+	}
+}
+
+func TestFault(t *testing.T) {
+	data, err := EncodeFault(3, "no function at 0x10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = DecodeResponse(data)
+	var fault *Fault
+	if !errors.As(err, &fault) || fault.Code != 3 || fault.String != "no function at 0x10" {
+		t.Errorf("got %v, want fault 3", err)
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	tests := map[string]string{
+		"empty":            ``,
+		"not xml":          `hello`,
+		"wrong root":       `<methodCall></methodCall>`,
+		"empty response":   `<methodResponse></methodResponse>`,
+		"two params":       `<methodResponse><params><param><value>1</value></param><param><value>2</value></param></params></methodResponse>`,
+		"no params":        `<methodResponse><params></params></methodResponse>`,
+		"truncated":        `<methodResponse><params><param><value><int>1`,
+		"bad int":          `<methodResponse><params><param><value><int>x</int></value></param></params></methodResponse>`,
+		"bad boolean":      `<methodResponse><params><param><value><boolean>2</boolean></value></param></params></methodResponse>`,
+		"bad double":       `<methodResponse><params><param><value><double>.x</double></value></param></params></methodResponse>`,
+		"bad base64":       `<methodResponse><params><param><value><base64>!!</base64></value></param></params></methodResponse>`,
+		"bad time":         `<methodResponse><params><param><value><dateTime.iso8601>now</dateTime.iso8601></value></param></params></methodResponse>`,
+		"unknown type":     `<methodResponse><params><param><value><float>1</float></value></param></params></methodResponse>`,
+		"two types":        `<methodResponse><params><param><value><int>1</int><int>2</int></value></param></params></methodResponse>`,
+		"member no value":  `<methodResponse><params><param><value><struct><member><name>a</name></member></struct></value></param></params></methodResponse>`,
+		"array no data":    `<methodResponse><params><param><value><array><value>1</value></array></value></param></params></methodResponse>`,
+		"text in params":   `<methodResponse><params>junk</params></methodResponse>`,
+		"fault not struct": `<methodResponse><fault><value><int>1</int></value></fault></methodResponse>`,
+	}
+
+	for name, body := range tests {
+		if _, err := DecodeResponse([]byte(body)); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: got %v, want %v", name, err, ErrMalformed)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	type header struct {
+		Name string `xmlrpc:"name"`
+		Size uint64 `xmlrpc:"size"`
+		Addr uint64 `xmlrpc:"addr,hex"`
+	}
+
+	v := map[string]any{"name": "main", "size": int64(24), "addr": "0x10000", "extra": true}
+
+	got := header{}
+	if err := Unmarshal(v, &got); err != nil || got != (header{Name: "main", Size: 24, Addr: 0x10000}) {
+		t.Errorf("got %+v, %v", got, err)
+	}
+
+	var unknown *UnknownFieldError
+	if err := UnmarshalStrict(v, &header{}); !errors.As(err, &unknown) || unknown.Field != "extra" {
+		t.Errorf("got %v, want unknown field extra", err)
+	}
+
+	var typeErr *TypeError
+	if err := Unmarshal(map[string]any{"size": "big"}, &header{}); !errors.As(err, &typeErr) || !strings.Contains(typeErr.Path, "size") {
+		t.Errorf("got %v, want type error at size", err)
+	}
+
+	if err := Unmarshal(v, header{}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("got %v, want %v", err, ErrUnsupported)
+	}
+}
+
+func TestEncodeUnsupported(t *testing.T) {
+	for _, v := range []any{uint64(1 << 63), map[int]int{1: 1}, make(chan int)} {
+		if _, err := EncodeResponse(v); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%T: got %v, want %v", v, err, ErrUnsupported)
+		}
+	}
+}
+
+func TestUnmarshalHex64(t *testing.T) {
+	type addrs struct {
+		Addr   uint64 `xmlrpc:"addr,hex"`
+		Offset int64  `xmlrpc:"offset,hex"`
+	}
+
+	got := addrs{}
+	v := map[string]any{"addr": "0xffffffff80001000", "offset": "0X7fffffffffffffff"}
+	if err := Unmarshal(v, &got); err != nil || got != (addrs{Addr: 0xffffffff80001000, Offset: math.MaxInt64}) {
+		t.Errorf("got %+v, %v", got, err)
+	}
+
+	// values above MaxInt64 do not wrap to negative
+	var typeErr *TypeError
+	if err := Unmarshal(map[string]any{"offset": "0x8000000000000000"}, &addrs{}); !errors.As(err, &typeErr) {
+		t.Errorf("got %v, want type error", err)
+	}
+}
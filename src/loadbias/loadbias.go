@@ -0,0 +1,251 @@
+// Package loadbias finds runtime load address of a program in /proc/<pid>/maps or core file.
+package loadbias
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// NT_FILE note type of core files, "FILE".
+const ntFile = 0x46494c45
+
+const ntGNUBuildID = 3
+
+var (
+	ErrNotFound  = errors.New("no mapping matches program")
+	ErrNoNTFile  = errors.New("core file has no NT_FILE note")
+	ErrMalformed = errors.New("malformed mapping")
+)
+
+// Mapping is a file mapped into process memory, Offset is file offset in bytes.
+type Mapping struct {
+	Start  uint64
+	End    uint64
+	Offset uint64
+	Path   string
+}
+
+// ParseMaps parses /proc/<pid>/maps format, anonymous mappings are skipped.
+func ParseMaps(r io.Reader) ([]Mapping, error) {
+	result := []Mapping{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// 55d0c7a00000-55d0c7a02000 r--p 00000000 fd:01 1234   /usr/bin/cat
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || !strings.HasPrefix(fields[5], "/") {
+			continue
+		}
+
+		start, end, ok := strings.Cut(fields[0], "-")
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrMalformed, scanner.Text())
+		}
+
+		m := Mapping{Path: strings.TrimSuffix(strings.Join(fields[5:], " "), " (deleted)")}
+		var err error
+		if m.Start, err = strconv.ParseUint(start, 16, 64); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+		}
+
+		if m.End, err = strconv.ParseUint(end, 16, 64); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+		}
+
+		if m.Offset, err = strconv.ParseUint(fields[2], 16, 64); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+		}
+
+		result = append(result, m)
+	}
+
+	return result, scanner.Err()
+}
+
+// ProcessMappings returns file mappings of live process.
+func ProcessMappings(pid int) ([]Mapping, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", pid))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseMaps(f)
+}
+
+// CoreMappings returns file mappings from NT_FILE note of core file.
+func CoreMappings(path string) ([]Mapping, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	wordSize := 8
+	if f.Class == elf.ELFCLASS32 {
+		wordSize = 4
+	}
+
+	for _, p := range f.Progs {
+		if p.Type != elf.PT_NOTE {
+			continue
+		}
+
+		data, err := io.ReadAll(p.Open())
+		if err != nil {
+			return nil, err
+		}
+
+		for _, n := range notes(data, f.ByteOrder) {
+			if n.name == "CORE" && n.typ == ntFile {
+				return parseNTFile(n.desc, f.ByteOrder, wordSize)
+			}
+		}
+	}
+
+	return nil, ErrNoNTFile
+}
+
+// NT_FILE: count, page size, count * (start, end, offset in pages), count * filename.
+func parseNTFile(desc []byte, order binary.ByteOrder, wordSize int) ([]Mapping, error) {
+	word := func(i int) (uint64, bool) {
+		off := i * wordSize
+		if off+wordSize > len(desc) {
+			return 0, false
+		}
+
+		if wordSize == 4 {
+			return uint64(order.Uint32(desc[off:])), true
+		}
+
+		return order.Uint64(desc[off:]), true
+	}
+
+	count, ok1 := word(0)
+	pageSize, ok2 := word(1)
+	if !ok1 || !ok2 || count > uint64(len(desc)) || (2+3*int(count))*wordSize > len(desc) {
+		return nil, fmt.Errorf("%w: bad NT_FILE header", ErrMalformed)
+	}
+
+	names := desc[(2+3*int(count))*wordSize:]
+	result := make([]Mapping, count)
+	for i := range result {
+		start, _ := word(2 + 3*i)
+		end, _ := word(3 + 3*i)
+		offset, _ := word(4 + 3*i)
+
+		name, rest, ok := bytes.Cut(names, []byte{0})
+		if !ok {
+			return nil, fmt.Errorf("%w: NT_FILE names are truncated", ErrMalformed)
+		}
+		names = rest
+
+		result[i] = Mapping{Start: start, End: end, Offset: offset * pageSize, Path: string(name)}
+	}
+
+	return result, nil
+}
+
+type note struct {
+	name string
+	typ  uint32
+	desc []byte
+}
+
+func notes(data []byte, order binary.ByteOrder) []note {
+	result := []note{}
+	for len(data) >= 12 {
+		nameSize := int(order.Uint32(data[0:]))
+		descSize := int(order.Uint32(data[4:]))
+		typ := order.Uint32(data[8:])
+		data = data[12:]
+
+		nameEnd := (nameSize + 3) &^ 3
+		descEnd := nameEnd + (descSize+3)&^3
+		if nameSize > len(data) || nameEnd+descSize > len(data) {
+			break
+		}
+
+		result = append(result, note{
+			name: strings.TrimRight(string(data[:nameSize]), "\x00"),
+			typ:  typ,
+			desc: data[nameEnd : nameEnd+descSize],
+		})
+
+		if descEnd > len(data) {
+			break
+		}
+		data = data[descEnd:]
+	}
+
+	return result
+}
+
+// BuildID returns hex encoded GNU build-id of ELF file at path.
+func BuildID(path string) (string, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_NOTE {
+			continue
+		}
+
+		data, err := s.Data()
+		if err != nil {
+			return "", err
+		}
+
+		for _, n := range notes(data, f.ByteOrder) {
+			if n.name == "GNU" && n.typ == ntGNUBuildID {
+				return hex.EncodeToString(n.desc), nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// Find returns address program name was loaded at, name is a file name or hex build-id.
+// Lowest mapping of matching file is used, its file offset is subtracted.
+func Find(mappings []Mapping, name string) (uint64, error) {
+	buildIDs := map[string]string{}
+	matches := func(path string) bool {
+		if filepath.Base(path) == filepath.Base(name) {
+			return true
+		}
+
+		id, ok := buildIDs[path]
+		if !ok {
+			id, _ = BuildID(path)
+			buildIDs[path] = id
+		}
+
+		return id != "" && strings.EqualFold(id, name)
+	}
+
+	var found *Mapping
+	for i, m := range mappings {
+		if (found == nil || m.Start < found.Start) && matches(m.Path) {
+			found = &mappings[i]
+		}
+	}
+
+	if found == nil {
+		return 0, fmt.Errorf("%w %s", ErrNotFound, name)
+	}
+
+	return found.Start - found.Offset, nil
+}
@@ -0,0 +1,197 @@
+package loadbias
+
+import (
+	"bytes"
+	"debug/elf"
+	"decompelf/src/tinyelf"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const maps = `55d0c7a00000-55d0c7a02000 r--p 00000000 fd:01 1234   /usr/bin/cat
+55d0c7a02000-55d0c7a07000 r-xp 00002000 fd:01 1234   /usr/bin/cat
+55d0c8000000-55d0c8021000 rw-p 00000000 00:00 0      [heap]
+7f1e2a000000-7f1e2a001000 r--p 00000000 fd:01 99     /tmp/my program (deleted)
+7ffd5e9f0000-7ffd5ea11000 rw-p 00000000 00:00 0
+`
+
+func TestParseMaps(t *testing.T) {
+	got, err := ParseMaps(strings.NewReader(maps))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Mapping{
+		{Start: 0x55d0c7a00000, End: 0x55d0c7a02000, Offset: 0, Path: "/usr/bin/cat"},
+		{Start: 0x55d0c7a02000, End: 0x55d0c7a07000, Offset: 0x2000, Path: "/usr/bin/cat"},
+		{Start: 0x7f1e2a000000, End: 0x7f1e2a001000, Offset: 0, Path: "/tmp/my program"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseMapsMalformed(t *testing.T) {
+	for _, line := range []string{
+		"55d0c7a00000 r--p 00000000 fd:01 1234 /usr/bin/cat",
+		"zz-55d0c7a02000 r--p 00000000 fd:01 1234 /usr/bin/cat",
+		"55d0c7a00000-55d0c7a02000 r--p offset fd:01 1234 /usr/bin/cat",
+	} {
+		if _, err := ParseMaps(strings.NewReader(line)); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: got %v, want %v", line, err, ErrMalformed)
+		}
+	}
+}
+
+// ntFileDesc returns NT_FILE descriptor of 64-bit core with 4096 byte pages.
+func ntFileDesc(mappings []Mapping) []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, []uint64{uint64(len(mappings)), 4096})
+	for _, m := range mappings {
+		binary.Write(buf, binary.LittleEndian, []uint64{m.Start, m.End, m.Offset / 4096})
+	}
+
+	for _, m := range mappings {
+		buf.WriteString(m.Path + "\x00")
+	}
+
+	return buf.Bytes()
+}
+
+func makeNote(name string, typ uint32, desc []byte) []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, []uint32{uint32(len(name) + 1), uint32(len(desc)), typ})
+	buf.WriteString(name + "\x00")
+	buf.Write(make([]byte, (4-buf.Len()%4)%4))
+	buf.Write(desc)
+	buf.Write(make([]byte, (4-buf.Len()%4)%4))
+
+	return buf.Bytes()
+}
+
+// writeCore writes ELF64 core file with a single PT_NOTE segment holding notes.
+func writeCore(t *testing.T, notes []byte) string {
+	header := elf.Header64{
+		Ident:     [16]byte{0x7f, 'E', 'L', 'F', byte(elf.ELFCLASS64), byte(elf.ELFDATA2LSB), byte(elf.EV_CURRENT)},
+		Type:      uint16(elf.ET_CORE),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     64,
+		Ehsize:    64,
+		Phentsize: 56,
+		Phnum:     1,
+	}
+	prog := elf.Prog64{Type: uint32(elf.PT_NOTE), Off: 64 + 56, Filesz: uint64(len(notes)), Align: 4}
+
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, header)
+	binary.Write(buf, binary.LittleEndian, prog)
+	buf.Write(notes)
+
+	path := filepath.Join(t.TempDir(), "core")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestCoreMappings(t *testing.T) {
+	want := []Mapping{
+		{Start: 0x400000, End: 0x401000, Offset: 0, Path: "/usr/bin/cat"},
+		{Start: 0x401000, End: 0x405000, Offset: 0x1000, Path: "/usr/bin/cat"},
+		{Start: 0x7f0000000000, End: 0x7f0000002000, Offset: 0, Path: "/lib/libc.so.6"},
+	}
+
+	notes := append(makeNote("CORE", uint32(elf.NT_PRSTATUS), make([]byte, 10)), makeNote("CORE", ntFile, ntFileDesc(want))...)
+	got, err := CoreMappings(writeCore(t, notes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestCoreMappingsNoNTFile(t *testing.T) {
+	_, err := CoreMappings(writeCore(t, makeNote("CORE", uint32(elf.NT_PRSTATUS), make([]byte, 8))))
+	if !errors.Is(err, ErrNoNTFile) {
+		t.Errorf("got %v, want %v", err, ErrNoNTFile)
+	}
+}
+
+func TestCoreMappingsTruncated(t *testing.T) {
+	desc := ntFileDesc([]Mapping{{Start: 0x400000, End: 0x401000, Path: "/usr/bin/cat"}})
+
+	tests := map[string][]byte{
+		"header":        desc[:12],
+		"one mapping":   desc[:24],
+		"ranges":        desc[:32],
+		"names":         desc[:len(desc)-3],
+		"huge count":    append(binary.LittleEndian.AppendUint64(nil, 1<<62), desc[8:]...),
+		"count overrun": append(binary.LittleEndian.AppendUint64(nil, 2), desc[8:]...),
+	}
+
+	for name, d := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := CoreMappings(writeCore(t, makeNote("CORE", ntFile, d)))
+			if !errors.Is(err, ErrMalformed) {
+				t.Errorf("got %v, want %v", err, ErrMalformed)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prog")
+	e := tinyelf.New64(path, elf.EM_X86_64, 0, binary.LittleEndian, uint(elf.ET_DYN))
+	e.SetBuildID([]byte{0xde, 0xad, 0xbe, 0xef})
+	if err := e.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	mappings := []Mapping{
+		{Start: 0x7f0000001000, End: 0x7f0000002000, Offset: 0x1000, Path: "/lib/libc.so.6"},
+		{Start: 0x555555556000, End: 0x555555557000, Offset: 0x1000, Path: path},
+		{Start: 0x555555555000, End: 0x555555556000, Offset: 0, Path: path},
+	}
+
+	tests := []struct {
+		name string
+		want uint64
+		err  error
+	}{
+		{name: "prog", want: 0x555555555000},
+		{name: "/other/dir/prog", want: 0x555555555000},
+		{name: "libc.so.6", want: 0x7f0000000000},
+		{name: "DEADBEEF", want: 0x555555555000},
+		{name: "cafe", err: ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		got, err := Find(mappings, tt.name)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("%s: got 0x%x, %v, want 0x%x, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestBuildID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prog")
+	e := tinyelf.New32(path, elf.EM_ARM, 0, binary.LittleEndian, uint(elf.ET_EXEC))
+	e.SetBuildID([]byte{1, 2, 3, 4, 5})
+	if err := e.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := BuildID(path)
+	if err != nil || id != "0102030405" {
+		t.Errorf("got %s, %v, want 0102030405", id, err)
+	}
+}
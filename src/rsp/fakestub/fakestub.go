@@ -0,0 +1,241 @@
+// Package fakestub is an in-process GDB Remote Serial Protocol stub for tests.
+package fakestub
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Stub struct {
+	// Offsets is qOffsets reply, ex. "Text=1000;Data=1000;Bss=1000", empty - unsupported.
+	Offsets string
+	// NoAck enables QStartNoAckMode.
+	NoAck bool
+	// Console is sent as "O" output packet before every reply if set.
+	Console string
+
+	listener net.Listener
+	mu       sync.Mutex
+	memory   map[uint64][]byte
+	packets  []string
+	corrupt  int
+	nack     int
+}
+
+// New starts stub on random local port. Call Close when done.
+func New(offsets string) (*Stub, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stub{Offsets: offsets, listener: l, memory: map[uint64][]byte{}}
+	go s.serve()
+
+	return s, nil
+}
+
+// Addr returns host:port of stub.
+func (s *Stub) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *Stub) Close() error {
+	return s.listener.Close()
+}
+
+// SetMemory places data at target address addr.
+func (s *Stub) SetMemory(addr uint64, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.memory[addr] = data
+}
+
+// Corrupt sends next n replies with bad checksum, they are resent after client nack.
+func (s *Stub) Corrupt(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.corrupt = n
+}
+
+// Nack rejects next n client packets with "-", client has to resend them.
+func (s *Stub) Nack(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nack = n
+}
+
+// take decrements counter and returns true if it was positive.
+func (s *Stub) take(counter *int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if *counter <= 0 {
+		return false
+	}
+	*counter--
+
+	return true
+}
+
+// Packets returns received packets.
+func (s *Stub) Packets() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.packets...)
+}
+
+func (s *Stub) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handle(conn)
+	}
+}
+
+func (s *Stub) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	noAck := false
+	for {
+		if _, err := r.ReadString('$'); err != nil {
+			return
+		}
+
+		body, err := r.ReadString('#')
+		if err != nil {
+			return
+		}
+		body = body[:len(body)-1]
+
+		var sum [2]byte
+		if _, err = io.ReadFull(r, sum[:]); err != nil {
+			return
+		}
+
+		if !noAck {
+			ack := "+"
+			if s.take(&s.nack) {
+				ack = "-"
+			}
+
+			if _, err = conn.Write([]byte(ack)); err != nil {
+				return
+			}
+
+			if ack == "-" {
+				continue
+			}
+		}
+
+		s.mu.Lock()
+		s.packets = append(s.packets, body)
+		console := s.Console
+		s.mu.Unlock()
+
+		if console != "" && !s.send(conn, r, "O"+hex.EncodeToString([]byte(console)), noAck) {
+			return
+		}
+
+		reply := s.reply(body)
+		if !s.send(conn, r, reply, noAck) {
+			return
+		}
+
+		if body == "QStartNoAckMode" && reply == "OK" {
+			noAck = true
+		}
+	}
+}
+
+// send writes packet and waits for its ack, packet is resent on nack.
+func (s *Stub) send(conn net.Conn, r *bufio.Reader, data string, noAck bool) bool {
+	for {
+		sum := checksum(data)
+		if s.take(&s.corrupt) {
+			sum ^= 0xff
+		}
+
+		if _, err := fmt.Fprintf(conn, "$%s#%02x", data, sum); err != nil {
+			return false
+		}
+
+		if noAck {
+			return true
+		}
+
+		ack, err := r.ReadByte()
+		if err != nil {
+			return false
+		}
+
+		if ack == '+' {
+			return true
+		}
+	}
+}
+
+func (s *Stub) reply(packet string) string {
+	switch {
+	case strings.HasPrefix(packet, "qSupported"):
+		if s.NoAck {
+			return "PacketSize=4000;QStartNoAckMode+"
+		}
+		return "PacketSize=4000"
+	case packet == "QStartNoAckMode":
+		if s.NoAck {
+			return "OK"
+		}
+		return ""
+	case packet == "qOffsets":
+		return s.Offsets
+	case packet == "?":
+		return "S05"
+	case strings.HasPrefix(packet, "m"):
+		a, n, ok := strings.Cut(packet[1:], ",")
+		addr, err1 := strconv.ParseUint(a, 16, 64)
+		size, err2 := strconv.ParseUint(n, 16, 32)
+		if !ok || err1 != nil || err2 != nil {
+			return "E01"
+		}
+
+		if data, ok := s.read(addr, int(size)); ok {
+			return hex.EncodeToString(data)
+		}
+
+		return "E14"
+	}
+
+	return ""
+}
+
+func (s *Stub) read(addr uint64, size int) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for start, data := range s.memory {
+		if addr >= start && addr+uint64(size) <= start+uint64(len(data)) {
+			return data[addr-start : addr-start+uint64(size)], true
+		}
+	}
+
+	return nil, false
+}
+
+func checksum(data string) uint8 {
+	var sum uint8
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+
+	return sum
+}
@@ -0,0 +1,304 @@
+// Package rsp is a minimal GDB Remote Serial Protocol client for gdbserver and QEMU stubs.
+package rsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnsupported = errors.New("packet is not supported by stub")
+	ErrChecksum    = errors.New("bad packet checksum")
+	ErrMalformed   = errors.New("malformed reply")
+)
+
+// ErrorReply is "Exx" reply of stub.
+type ErrorReply struct {
+	Packet string
+	Code   int
+}
+
+func (e *ErrorReply) Error() string {
+	return fmt.Sprintf("%s: stub error %02x", e.Packet, e.Code)
+}
+
+// Offsets is qOffsets reply. Segments is set when stub reported TextSeg/DataSeg addresses instead of offsets.
+type Offsets struct {
+	Text     uint64
+	Data     uint64
+	Bss      uint64
+	Segments bool
+}
+
+type Client struct {
+	// Timeout of a single packet exchange, 0 - no timeout.
+	Timeout time.Duration
+
+	conn  net.Conn
+	r     *bufio.Reader
+	noAck bool
+}
+
+// Dial connects to stub at addr (host:port) and performs handshake.
+func Dial(ctx context.Context, addr string, timeout time.Duration) (*Client, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{Timeout: timeout, conn: conn, r: bufio.NewReader(conn)}
+	if err = c.handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("rsp handshake failed: %w", err)
+	}
+
+	return c, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) handshake() error {
+	// stubs may send ack for a packet of previous session
+	if _, err := c.conn.Write([]byte("+")); err != nil {
+		return err
+	}
+
+	features, err := c.Command("qSupported:multiprocess+;swbreak+;hwbreak+")
+	if err != nil {
+		return err
+	}
+
+	if strings.Contains(features, "QStartNoAckMode+") {
+		reply, err := c.Command("QStartNoAckMode")
+		if err != nil {
+			return err
+		}
+
+		c.noAck = reply == "OK"
+	}
+
+	return nil
+}
+
+// Command sends packet data and returns reply. Empty reply means unsupported packet.
+func (c *Client) Command(data string) (string, error) {
+	if c.Timeout > 0 {
+		if err := c.conn.SetDeadline(time.Now().Add(c.Timeout)); err != nil {
+			return "", err
+		}
+	}
+
+	packet := fmt.Sprintf("$%s#%02x", data, checksum([]byte(data)))
+	for {
+		if _, err := c.conn.Write([]byte(packet)); err != nil {
+			return "", err
+		}
+
+		if c.noAck {
+			break
+		}
+
+		ack, err := c.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+
+		if ack == '+' {
+			break
+		}
+
+		if ack != '-' {
+			return "", fmt.Errorf("%w: expected ack, got %q", ErrMalformed, ack)
+		}
+	}
+
+	for {
+		reply, err := c.receive()
+		if err != nil {
+			return "", err
+		}
+
+		// console output of the stub
+		if len(reply) > 1 && reply[0] == 'O' && isHex(reply[1:]) {
+			continue
+		}
+
+		return reply, nil
+	}
+}
+
+func (c *Client) receive() (string, error) {
+	for {
+		if _, err := c.r.ReadString('$'); err != nil {
+			return "", err
+		}
+
+		body, err := c.r.ReadString('#')
+		if err != nil {
+			return "", err
+		}
+		body = body[:len(body)-1]
+
+		var sum [2]byte
+		if _, err = io.ReadFull(c.r, sum[:]); err != nil {
+			return "", err
+		}
+
+		want, err := strconv.ParseUint(string(sum[:]), 16, 8)
+		if err != nil || uint8(want) != checksum([]byte(body)) {
+			if c.noAck {
+				return "", ErrChecksum
+			}
+
+			if _, err = c.conn.Write([]byte("-")); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		if !c.noAck {
+			if _, err = c.conn.Write([]byte("+")); err != nil {
+				return "", err
+			}
+		}
+
+		return decode(body)
+	}
+}
+
+// decode expands run-length encoding and escapes.
+func decode(body string) (string, error) {
+	out := make([]byte, 0, len(body))
+	for i := 0; i < len(body); i++ {
+		switch b := body[i]; b {
+		case '}':
+			if i+1 >= len(body) {
+				return "", fmt.Errorf("%w: truncated escape", ErrMalformed)
+			}
+			i++
+			out = append(out, body[i]^0x20)
+		case '*':
+			if i+1 >= len(body) || len(out) == 0 {
+				return "", fmt.Errorf("%w: bad run-length encoding", ErrMalformed)
+			}
+			i++
+			for n := int(body[i]) - 29; n > 0; n-- {
+				out = append(out, out[len(out)-1])
+			}
+		default:
+			out = append(out, b)
+		}
+	}
+
+	return string(out), nil
+}
+
+func checksum(data []byte) uint8 {
+	var sum uint8
+	for _, b := range data {
+		sum += b
+	}
+
+	return sum
+}
+
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func replyError(packet string, reply string) error {
+	if reply == "" {
+		return fmt.Errorf("%w: %s", ErrUnsupported, packet)
+	}
+
+	if len(reply) == 3 && reply[0] == 'E' {
+		code, err := strconv.ParseUint(reply[1:], 16, 8)
+		if err == nil {
+			return &ErrorReply{Packet: packet, Code: int(code)}
+		}
+	}
+
+	return nil
+}
+
+// Offsets returns section offsets reported by qOffsets.
+func (c *Client) Offsets() (*Offsets, error) {
+	reply, err := c.Command("qOffsets")
+	if err != nil {
+		return nil, err
+	}
+
+	if err = replyError("qOffsets", reply); err != nil {
+		return nil, err
+	}
+
+	result := &Offsets{}
+	for _, kv := range strings.Split(reply, ";") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: qOffsets %s", ErrMalformed, reply)
+		}
+
+		value, err := strconv.ParseUint(v, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: qOffsets %s", ErrMalformed, reply)
+		}
+
+		switch k {
+		case "Text":
+			result.Text = value
+		case "Data":
+			result.Data = value
+		case "Bss":
+			result.Bss = value
+		case "TextSeg":
+			result.Text = value
+			result.Segments = true
+		case "DataSeg":
+			result.Data = value
+			result.Segments = true
+		}
+	}
+
+	// Bss defaults to Data offset, DataSeg defaults to TextSeg
+	if !strings.Contains(reply, "Bss=") {
+		result.Bss = result.Data
+	}
+	if result.Segments && !strings.Contains(reply, "DataSeg=") {
+		result.Data = result.Text
+		result.Bss = result.Text
+	}
+
+	return result, nil
+}
+
+// ReadMemory reads n bytes of target memory at addr.
+func (c *Client) ReadMemory(addr uint64, n int) ([]byte, error) {
+	packet := fmt.Sprintf("m%x,%x", addr, n)
+	reply, err := c.Command(packet)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = replyError(packet, reply); err != nil {
+		return nil, err
+	}
+
+	data, err := hex.DecodeString(reply)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrMalformed, packet, err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,169 @@
+package rsp
+
+import (
+	"bytes"
+	"context"
+	"decompelf/src/rsp/fakestub"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func dial(t *testing.T, s *fakestub.Stub) *Client {
+	c, err := Dial(context.Background(), s.Addr(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func newStub(t *testing.T, offsets string) *fakestub.Stub {
+	s, err := fakestub.New(offsets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+func TestOffsets(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  Offsets
+	}{
+		{"Text=1000;Data=1000;Bss=1000", Offsets{Text: 0x1000, Data: 0x1000, Bss: 0x1000}},
+		// Bss defaults to Data
+		{"Text=1000;Data=2000", Offsets{Text: 0x1000, Data: 0x2000, Bss: 0x2000}},
+		{"Text=0;Data=0;Bss=3000", Offsets{Bss: 0x3000}},
+		// DataSeg defaults to TextSeg
+		{"TextSeg=400000", Offsets{Text: 0x400000, Data: 0x400000, Bss: 0x400000, Segments: true}},
+		{"TextSeg=400000;DataSeg=600000", Offsets{Text: 0x400000, Data: 0x600000, Bss: 0x600000, Segments: true}},
+	}
+
+	for _, tt := range tests {
+		for _, noAck := range []bool{false, true} {
+			s := newStub(t, tt.reply)
+			s.NoAck = noAck
+
+			got, err := dial(t, s).Offsets()
+			if err != nil || *got != tt.want {
+				t.Errorf("%s, no ack %v: got %+v, %v, want %+v", tt.reply, noAck, got, err, tt.want)
+			}
+		}
+	}
+}
+
+func TestOffsetsErrors(t *testing.T) {
+	var reply *ErrorReply
+	if _, err := dial(t, newStub(t, "E01")).Offsets(); !errors.As(err, &reply) || reply.Code != 1 || reply.Packet != "qOffsets" {
+		t.Errorf("got %v, want stub error 01", err)
+	}
+
+	if _, err := dial(t, newStub(t, "")).Offsets(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("got %v, want %v", err, ErrUnsupported)
+	}
+
+	for _, bad := range []string{"Text=zz;Data=0", "junk", "Text=1000;Data"} {
+		if _, err := dial(t, newStub(t, bad)).Offsets(); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: got %v, want %v", bad, err, ErrMalformed)
+		}
+	}
+}
+
+func TestNoAckHandshake(t *testing.T) {
+	s := newStub(t, "Text=0;Data=0;Bss=0")
+	s.NoAck = true
+	c := dial(t, s)
+	if !c.noAck {
+		t.Errorf("no ack mode is not enabled")
+	}
+
+	if !slices.Contains(s.Packets(), "QStartNoAckMode") {
+		t.Errorf("got packets %v", s.Packets())
+	}
+}
+
+func TestReadMemory(t *testing.T) {
+	s := newStub(t, "")
+	s.SetMemory(0x8000, []byte{0x55, 0x48, 0x89, 0xe5, 0x23, 0x24})
+	c := dial(t, s)
+
+	got, err := c.ReadMemory(0x8001, 4)
+	if err != nil || !bytes.Equal(got, []byte{0x48, 0x89, 0xe5, 0x23}) {
+		t.Errorf("got %x, %v", got, err)
+	}
+
+	var reply *ErrorReply
+	if _, err = c.ReadMemory(0x9000, 4); !errors.As(err, &reply) || reply.Code != 0x14 {
+		t.Errorf("got %v, want stub error 14", err)
+	}
+}
+
+func TestChecksumRetransmit(t *testing.T) {
+	s := newStub(t, "Text=1000;Data=1000;Bss=1000")
+	c := dial(t, s)
+
+	s.Corrupt(2)
+	got, err := c.Offsets()
+	if err != nil || got.Text != 0x1000 {
+		t.Errorf("got %+v, %v", got, err)
+	}
+}
+
+func TestChecksumNoAck(t *testing.T) {
+	s := newStub(t, "Text=1000;Data=1000;Bss=1000")
+	s.NoAck = true
+	c := dial(t, s)
+
+	s.Corrupt(1)
+	if _, err := c.Offsets(); !errors.Is(err, ErrChecksum) {
+		t.Errorf("got %v, want %v", err, ErrChecksum)
+	}
+}
+
+func TestNackResend(t *testing.T) {
+	s := newStub(t, "Text=1000;Data=1000;Bss=1000")
+	c := dial(t, s)
+
+	s.Nack(2)
+	got, err := c.Offsets()
+	if err != nil || got.Text != 0x1000 {
+		t.Errorf("got %+v, %v", got, err)
+	}
+}
+
+func TestConsoleOutputSkipped(t *testing.T) {
+	s := newStub(t, "Text=2000;Data=2000;Bss=2000")
+	s.Console = "hello\n"
+
+	got, err := dial(t, s).Offsets()
+	if err != nil || got.Text != 0x2000 {
+		t.Errorf("got %+v, %v", got, err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := map[string]string{
+		"OK":      "OK",
+		"0* ":     "0000",
+		"ab*!c":   "abbbbbc",
+		"a}\x03b": "a#b",
+		"}]}\x04": "}$",
+	}
+
+	for body, want := range tests {
+		if got, err := decode(body); err != nil || got != want {
+			t.Errorf("%q: got %q, %v, want %q", body, got, err, want)
+		}
+	}
+
+	for _, bad := range []string{"a}", "*a", "a*"} {
+		if _, err := decode(bad); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%q: got %v, want %v", bad, err, ErrMalformed)
+		}
+	}
+}
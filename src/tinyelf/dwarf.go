@@ -0,0 +1,872 @@
+package tinyelf
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"path/filepath"
+	"sort"
+)
+
+// DWARF 4 is used, it is supported by every gdb and lldb still in use.
+const dwarfVersion = 4
+
+type form uint8
+
+const (
+	formAddr        form = 0x01
+	formData2       form = 0x05
+	formData4       form = 0x06
+	formData8       form = 0x07
+	formString      form = 0x08
+	formData1       form = 0x0b
+	formFlag        form = 0x0c
+	formSdata       form = 0x0d
+	formUdata       form = 0x0f
+	formRef4        form = 0x13
+	formSecOffset   form = 0x17
+	formExprloc     form = 0x18
+	formFlagPresent form = 0x19
+)
+
+const (
+	langC99        = 0x0c
+	lneEndSequence = 0x01
+	lneSetAddress  = 0x02
+	lnsCopy        = 0x01
+	lnsAdvancePC   = 0x02
+	lnsAdvanceLine = 0x03
+	lineOpcodeBase = 13
+	producer       = "decompelf"
+)
+
+// LineRow maps instruction address to 1-based source line.
+type LineRow struct {
+	Address uint64
+	Line    int
+}
+
+// LineSequence is a contiguous address range, usually a function.
+type LineSequence struct {
+	Rows []LineRow
+	End  uint64 // address after the last instruction
+}
+
+// Source is a decompiled source file, emitted as DWARF compile unit with line table.
+type Source struct {
+	Path      string
+	Text      []byte
+	Sequences []LineSequence
+}
+
+// AddSource adds source file s, it is written to s.Path by Write.
+func (t *TinyELF) AddSource(s *Source) {
+	if t.slide != 0 {
+		sequences := make([]LineSequence, len(s.Sequences))
+		for i, seq := range s.Sequences {
+			sequences[i] = LineSequence{Rows: make([]LineRow, len(seq.Rows)), End: seq.End + t.slide}
+			for j, r := range seq.Rows {
+				sequences[i].Rows[j] = LineRow{Address: r.Address + t.slide, Line: r.Line}
+			}
+		}
+
+		rebased := *s
+		rebased.Sequences = sequences
+		s = &rebased
+	}
+
+	t.sources = append(t.sources, s)
+}
+
+// DW_ATE_* base type encodings.
+const (
+	EncodingAddress      = 0x01
+	EncodingBoolean      = 0x02
+	EncodingFloat        = 0x04
+	EncodingSigned       = 0x05
+	EncodingSignedChar   = 0x06
+	EncodingUnsigned     = 0x07
+	EncodingUnsignedChar = 0x08
+)
+
+type TypeKind int
+
+const (
+	KindBase TypeKind = iota
+	KindPointer
+	KindStruct
+	KindUnion
+	KindEnum
+	KindTypedef
+	KindArray
+)
+
+// Type is emitted as DWARF type entry in every compile unit referencing it.
+type Type struct {
+	Kind TypeKind
+	Name string // empty for anonymous types
+	Size uint64
+	// Encoding is DW_ATE_* of base type.
+	Encoding uint8
+	// Target is pointed to, aliased or array element type, nil for void.
+	Target      *Type
+	Count       uint64 // array elements, unknown if zero
+	Members     []*Member
+	Enumerators []*Enumerator
+}
+
+// ByteSize returns size of t, following typedefs and multiplying array elements.
+// Size of typedef or array cycle without sizes is unknown, 0.
+func (t *Type) ByteSize() uint64 {
+	return t.byteSize(map[*Type]bool{})
+}
+
+func (t *Type) byteSize(visited map[*Type]bool) uint64 {
+	if t == nil || visited[t] {
+		return 0
+	}
+	visited[t] = true
+
+	switch {
+	case t.Size != 0:
+		return t.Size
+	case t.Kind == KindTypedef:
+		return t.Target.byteSize(visited)
+	case t.Kind == KindArray:
+		return t.Count * t.Target.byteSize(visited)
+	}
+
+	return 0
+}
+
+type Member struct {
+	Name   string
+	Type   *Type
+	Offset uint64
+}
+
+type Enumerator struct {
+	Name  string
+	Value int64
+}
+
+// Global is emitted as DW_TAG_variable with static address.
+type Global struct {
+	Name    string
+	Address uint64
+	Type    *Type
+	Static  bool
+}
+
+func (t *TinyELF) AddGlobal(g *Global) {
+	rebased := *g
+	rebased.Address += t.slide
+	t.globals = append(t.globals, &rebased)
+}
+
+// Variable is a function parameter or local variable.
+type Variable struct {
+	Name string
+	Type *Type
+	// Location is DWARF expression, see LocFrameBase and LocRegister. Variable is optimized out if empty.
+	Location []byte
+}
+
+// FrameBaseCFA is DW_OP_call_frame_cfa, requires call frame information for function.
+var FrameBaseCFA = []byte{0x9c}
+
+// FrameBaseRegister returns DW_OP_breg expression, frame base is the value of register reg.
+func FrameBaseRegister(reg uint64) []byte {
+	if reg < 32 {
+		return []byte{0x70 + byte(reg), 0}
+	}
+
+	return append(appendUleb([]byte{0x92}, reg), 0)
+}
+
+// LocFrameBase returns DW_OP_fbreg location expression.
+func LocFrameBase(offset int64) []byte {
+	return appendSleb([]byte{0x91}, offset)
+}
+
+// LocRegister returns DW_OP_reg location expression for DWARF register number.
+func LocRegister(reg uint64) []byte {
+	if reg < 32 {
+		return []byte{0x50 + byte(reg)}
+	}
+
+	return appendUleb([]byte{0x90}, reg)
+}
+
+// Function is emitted as DW_TAG_subprogram, in compile unit of Source covering LowPC if any.
+type Function struct {
+	Name   string
+	LowPC  uint64
+	HighPC uint64 // address after the last instruction
+	// Static functions are not visible outside of compile unit, same as local symbols.
+	Static bool
+	// FrameBase is DWARF expression for DW_OP_fbreg locations.
+	FrameBase []byte
+	Params    []*Variable
+	Locals    []*Variable
+}
+
+func (t *TinyELF) AddFunction(f *Function) {
+	rebased := *f
+	rebased.LowPC += t.slide
+	rebased.HighPC += t.slide
+	t.functions = append(t.functions, &rebased)
+}
+
+type addrRange struct {
+	low  uint64
+	high uint64
+}
+
+type attr struct {
+	name  dwarf.Attr
+	form  form
+	value any
+}
+
+type die struct {
+	tag      dwarf.Tag
+	attrs    []attr
+	children []*die
+	code     uint64
+	offset   uint32
+}
+
+func (d *die) add(name dwarf.Attr, f form, value any) *die {
+	d.attrs = append(d.attrs, attr{name: name, form: f, value: value})
+	return d
+}
+
+func (d *die) child(tag dwarf.Tag) *die {
+	c := &die{tag: tag}
+	d.children = append(d.children, c)
+
+	return c
+}
+
+type dwarfBuf struct {
+	bytes.Buffer
+	order    binary.ByteOrder
+	addrSize int
+}
+
+func (b *dwarfBuf) u8(v uint8) {
+	b.WriteByte(v)
+}
+
+func (b *dwarfBuf) u16(v uint16) {
+	var buf [2]byte
+	b.order.PutUint16(buf[:], v)
+	b.Write(buf[:])
+}
+
+func (b *dwarfBuf) u32(v uint32) {
+	var buf [4]byte
+	b.order.PutUint32(buf[:], v)
+	b.Write(buf[:])
+}
+
+func (b *dwarfBuf) u64(v uint64) {
+	var buf [8]byte
+	b.order.PutUint64(buf[:], v)
+	b.Write(buf[:])
+}
+
+func (b *dwarfBuf) addr(v uint64) {
+	if b.addrSize == 4 {
+		b.u32(uint32(v))
+		return
+	}
+
+	b.u64(v)
+}
+
+func (b *dwarfBuf) str(s string) {
+	b.WriteString(s)
+	b.WriteByte(0)
+}
+
+func (b *dwarfBuf) uleb(v uint64) {
+	b.Write(appendUleb(nil, v))
+}
+
+func (b *dwarfBuf) sleb(v int64) {
+	b.Write(appendSleb(nil, v))
+}
+
+func appendUleb(buf []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			c |= 0x80
+		}
+		buf = append(buf, c)
+		if v == 0 {
+			return buf
+		}
+	}
+}
+
+func appendSleb(buf []byte, v int64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		s := c & 0x40
+		v >>= 7
+		if (v != 0 || s != 0) && (v != -1 || s == 0) {
+			c |= 0x80
+		}
+		buf = append(buf, c)
+		if c&0x80 == 0 {
+			return buf
+		}
+	}
+}
+
+func (t *TinyELF) addrSize() int {
+	if t.elf32 != nil {
+		return 4
+	}
+
+	return 8
+}
+
+func (t *TinyELF) newDwarfBuf() *dwarfBuf {
+	return &dwarfBuf{order: t.byteOrder, addrSize: t.addrSize()}
+}
+
+// dwarfSections builds .debug_abbrev, .debug_info, .debug_line and .debug_ranges.
+func (t *TinyELF) dwarfSections() ([]*Section, error) {
+	line := t.newDwarfBuf()
+	ranges := t.newDwarfBuf()
+	units := []*die{}
+
+	assigned := make([][]*Function, len(t.sources))
+	rest := []*Function{}
+	for _, f := range t.functions {
+		if i := t.sourceOf(f.LowPC); i >= 0 {
+			assigned[i] = append(assigned[i], f)
+		} else {
+			rest = append(rest, f)
+		}
+	}
+
+	for i, src := range t.sources {
+		cu := &die{tag: dwarf.TagCompileUnit}
+		u := newUnit(cu)
+		cu.add(dwarf.AttrProducer, formString, producer)
+		cu.add(dwarf.AttrLanguage, formData1, uint64(langC99))
+		cu.add(dwarf.AttrName, formString, src.Path)
+		cu.add(dwarf.AttrCompDir, formString, filepath.Dir(src.Path))
+		cu.add(dwarf.AttrLowpc, formAddr, uint64(0))
+		cu.add(dwarf.AttrRanges, formSecOffset, uint64(ranges.Len()))
+		cu.add(dwarf.AttrStmtList, formSecOffset, uint64(line.Len()))
+
+		cuRanges := []addrRange{}
+		for _, seq := range src.Sequences {
+			if len(seq.Rows) > 0 {
+				cuRanges = append(cuRanges, addrRange{low: seq.Rows[0].Address, high: seq.End})
+			}
+		}
+
+		for _, f := range assigned[i] {
+			sp := u.subprogram(f)
+			if l := src.lineOf(f.LowPC); l > 0 {
+				sp.add(dwarf.AttrDeclFile, formData1, uint64(1))
+				sp.add(dwarf.AttrDeclLine, formUdata, uint64(l))
+			}
+			cuRanges = append(cuRanges, addrRange{low: f.LowPC, high: f.HighPC})
+		}
+
+		writeRanges(ranges, cuRanges)
+		writeLineProgram(line, src)
+
+		units = append(units, cu)
+	}
+
+	if len(rest) > 0 || len(t.globals) > 0 {
+		cu := &die{tag: dwarf.TagCompileUnit}
+		u := newUnit(cu)
+		cu.add(dwarf.AttrProducer, formString, producer)
+		cu.add(dwarf.AttrLanguage, formData1, uint64(langC99))
+		cu.add(dwarf.AttrName, formString, filepath.Base(t.filename))
+		cu.add(dwarf.AttrLowpc, formAddr, uint64(0))
+		cu.add(dwarf.AttrRanges, formSecOffset, uint64(ranges.Len()))
+
+		cuRanges := []addrRange{}
+		for _, f := range rest {
+			u.subprogram(f)
+			cuRanges = append(cuRanges, addrRange{low: f.LowPC, high: f.HighPC})
+		}
+
+		for _, g := range t.globals {
+			u.global(g, t.locAddr(g.Address))
+		}
+
+		writeRanges(ranges, cuRanges)
+
+		units = append(units, cu)
+	}
+
+	abbrev, info := t.writeInfo(units)
+
+	result := []*Section{
+		{Name: ".debug_abbrev", Type: elf.SHT_PROGBITS, Data: abbrev, Addralign: 1},
+		{Name: ".debug_info", Type: elf.SHT_PROGBITS, Data: info, Addralign: 1},
+	}
+
+	if line.Len() > 0 {
+		result = append(result, &Section{Name: ".debug_line", Type: elf.SHT_PROGBITS, Data: line.Bytes(), Addralign: 1})
+	}
+
+	result = append(result, &Section{Name: ".debug_ranges", Type: elf.SHT_PROGBITS, Data: ranges.Bytes(), Addralign: 1})
+
+	return result, nil
+}
+
+type unit struct {
+	cu    *die
+	types map[*Type]*die
+}
+
+func newUnit(cu *die) *unit {
+	return &unit{cu: cu, types: map[*Type]*die{}}
+}
+
+func (u *unit) subprogram(f *Function) *die {
+	high := f.HighPC
+	if high <= f.LowPC {
+		high = f.LowPC + 1
+	}
+
+	sp := u.cu.child(dwarf.TagSubprogram)
+	sp.add(dwarf.AttrName, formString, f.Name)
+	if !f.Static {
+		sp.add(dwarf.AttrExternal, formFlagPresent, true)
+	}
+	sp.add(dwarf.AttrLowpc, formAddr, f.LowPC)
+	sp.add(dwarf.AttrHighpc, formData4, high-f.LowPC)
+
+	if len(f.FrameBase) > 0 {
+		sp.add(dwarf.AttrFrameBase, formExprloc, f.FrameBase)
+	}
+
+	for _, v := range f.Params {
+		u.variable(sp.child(dwarf.TagFormalParameter), v)
+	}
+
+	for _, v := range f.Locals {
+		u.variable(sp.child(dwarf.TagVariable), v)
+	}
+
+	return sp
+}
+
+func (u *unit) variable(d *die, v *Variable) {
+	d.add(dwarf.AttrName, formString, v.Name)
+
+	if v.Type != nil {
+		d.add(dwarf.AttrType, formRef4, u.typeRef(v.Type))
+	}
+
+	if len(v.Location) > 0 {
+		d.add(dwarf.AttrLocation, formExprloc, v.Location)
+	}
+}
+
+// typeRef returns type entry of t in this unit, adding it if needed.
+func (u *unit) typeRef(t *Type) *die {
+	if d, ok := u.types[t]; ok {
+		return d
+	}
+
+	tags := map[TypeKind]dwarf.Tag{
+		KindBase:    dwarf.TagBaseType,
+		KindPointer: dwarf.TagPointerType,
+		KindStruct:  dwarf.TagStructType,
+		KindUnion:   dwarf.TagUnionType,
+		KindEnum:    dwarf.TagEnumerationType,
+		KindTypedef: dwarf.TagTypedef,
+		KindArray:   dwarf.TagArrayType,
+	}
+
+	// added before members to break cycles like struct node { struct node *next; }
+	d := u.cu.child(tags[t.Kind])
+	u.types[t] = d
+
+	if t.Name != "" && t.Kind != KindArray && t.Kind != KindPointer {
+		d.add(dwarf.AttrName, formString, t.Name)
+	}
+
+	switch t.Kind {
+	case KindBase:
+		d.add(dwarf.AttrByteSize, formUdata, t.Size)
+		d.add(dwarf.AttrEncoding, formData1, uint64(t.Encoding))
+	case KindPointer:
+		d.add(dwarf.AttrByteSize, formUdata, t.Size)
+		if t.Target != nil {
+			d.add(dwarf.AttrType, formRef4, u.typeRef(t.Target))
+		}
+	case KindTypedef:
+		if t.Target != nil {
+			d.add(dwarf.AttrType, formRef4, u.typeRef(t.Target))
+		}
+	case KindArray:
+		if t.Target != nil {
+			d.add(dwarf.AttrType, formRef4, u.typeRef(t.Target))
+		}
+
+		sub := d.child(dwarf.TagSubrangeType)
+		if t.Count > 0 {
+			sub.add(dwarf.AttrCount, formUdata, t.Count)
+		}
+	case KindStruct, KindUnion:
+		d.add(dwarf.AttrByteSize, formUdata, t.Size)
+		for _, m := range t.Members {
+			md := d.child(dwarf.TagMember)
+			if m.Name != "" {
+				md.add(dwarf.AttrName, formString, m.Name)
+			}
+
+			if m.Type != nil {
+				md.add(dwarf.AttrType, formRef4, u.typeRef(m.Type))
+			}
+
+			if t.Kind == KindStruct {
+				md.add(dwarf.AttrDataMemberLoc, formUdata, m.Offset)
+			}
+		}
+
+		if len(t.Members) == 0 && t.Size == 0 {
+			d.add(dwarf.AttrDeclaration, formFlagPresent, true)
+		}
+	case KindEnum:
+		d.add(dwarf.AttrByteSize, formUdata, t.Size)
+		for _, e := range t.Enumerators {
+			d.child(dwarf.TagEnumerator).
+				add(dwarf.AttrName, formString, e.Name).
+				add(dwarf.AttrConstValue, formSdata, e.Value)
+		}
+	}
+
+	return d
+}
+
+func (u *unit) global(g *Global, loc []byte) {
+	d := u.cu.child(dwarf.TagVariable)
+	d.add(dwarf.AttrName, formString, g.Name)
+	if !g.Static {
+		d.add(dwarf.AttrExternal, formFlagPresent, true)
+	}
+
+	if g.Type != nil {
+		d.add(dwarf.AttrType, formRef4, u.typeRef(g.Type))
+	}
+
+	d.add(dwarf.AttrLocation, formExprloc, loc)
+}
+
+// locAddr returns DW_OP_addr location expression.
+func (t *TinyELF) locAddr(addr uint64) []byte {
+	b := t.newDwarfBuf()
+	b.u8(0x03)
+	b.addr(addr)
+
+	return b.Bytes()
+}
+
+// sourceOf returns index of source with line sequence covering addr, -1 if none.
+func (t *TinyELF) sourceOf(addr uint64) int {
+	for i, src := range t.sources {
+		for _, seq := range src.Sequences {
+			if len(seq.Rows) > 0 && addr >= seq.Rows[0].Address && addr < seq.End {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// lineOf returns line of the lowest row at or after addr in sequence covering addr, 0 if none.
+func (s *Source) lineOf(addr uint64) int {
+	for _, seq := range s.Sequences {
+		if len(seq.Rows) == 0 || addr < seq.Rows[0].Address || addr >= seq.End {
+			continue
+		}
+
+		line := 0
+		best := seq.End
+		for _, r := range seq.Rows {
+			if r.Address >= addr && r.Address < best {
+				best = r.Address
+				line = r.Line
+			}
+		}
+
+		return line
+	}
+
+	return 0
+}
+
+// writeRanges writes sorted and merged list of ranges.
+func writeRanges(b *dwarfBuf, list []addrRange) {
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].low < list[j].low
+	})
+
+	merged := []addrRange{}
+	for _, r := range list {
+		if r.high <= r.low {
+			r.high = r.low + 1
+		}
+
+		if n := len(merged); n > 0 && r.low <= merged[n-1].high {
+			merged[n-1].high = max(merged[n-1].high, r.high)
+			continue
+		}
+
+		merged = append(merged, r)
+	}
+
+	for _, r := range merged {
+		b.addr(r.low)
+		b.addr(r.high)
+	}
+
+	b.addr(0)
+	b.addr(0)
+}
+
+func writeLineProgram(b *dwarfBuf, src *Source) {
+	start := b.Len()
+	b.u32(0) // unit_length, patched below
+	b.u16(dwarfVersion)
+	headerLengthAt := b.Len()
+	b.u32(0) // header_length, patched below
+	headerStart := b.Len()
+
+	b.u8(1)    // minimum_instruction_length
+	b.u8(1)    // maximum_operations_per_instruction
+	b.u8(1)    // default_is_stmt
+	b.u8(0xfb) // line_base = -5
+	b.u8(14)   // line_range
+	b.u8(lineOpcodeBase)
+	b.Write([]byte{0, 1, 1, 1, 1, 0, 0, 0, 1, 0, 0, 1}) // standard_opcode_lengths
+
+	// include_directories
+	b.str(filepath.Dir(src.Path))
+	b.u8(0)
+
+	// file_names
+	b.str(filepath.Base(src.Path))
+	b.uleb(1) // directory index
+	b.uleb(0) // mtime
+	b.uleb(uint64(len(src.Text)))
+	b.u8(0)
+
+	b.order.PutUint32(b.Bytes()[headerLengthAt:], uint32(b.Len()-headerStart))
+
+	for _, seq := range src.Sequences {
+		if len(seq.Rows) == 0 {
+			continue
+		}
+
+		rows := append([]LineRow{}, seq.Rows...)
+		sort.SliceStable(rows, func(i, j int) bool {
+			return rows[i].Address < rows[j].Address
+		})
+
+		b.u8(0)
+		b.uleb(uint64(1 + b.addrSize))
+		b.u8(lneSetAddress)
+		b.addr(rows[0].Address)
+
+		addr := rows[0].Address
+		line := 1
+		for _, r := range rows {
+			if r.Address != addr {
+				b.u8(lnsAdvancePC)
+				b.uleb(r.Address - addr)
+				addr = r.Address
+			}
+
+			if r.Line != line {
+				b.u8(lnsAdvanceLine)
+				b.sleb(int64(r.Line - line))
+				line = r.Line
+			}
+
+			b.u8(lnsCopy)
+		}
+
+		if seq.End > addr {
+			b.u8(lnsAdvancePC)
+			b.uleb(seq.End - addr)
+		}
+
+		b.u8(0)
+		b.uleb(1)
+		b.u8(lneEndSequence)
+	}
+
+	b.order.PutUint32(b.Bytes()[start:], uint32(b.Len()-start-4))
+}
+
+type abbrevKey struct {
+	tag      dwarf.Tag
+	children bool
+	attrs    string
+}
+
+// writeInfo returns .debug_abbrev and .debug_info contents for units.
+func (t *TinyELF) writeInfo(units []*die) ([]byte, []byte) {
+	abbrev := t.newDwarfBuf()
+	codes := map[abbrevKey]uint64{}
+
+	var assign func(d *die)
+	assign = func(d *die) {
+		spec := []byte{}
+		for _, a := range d.attrs {
+			spec = appendUleb(spec, uint64(a.name))
+			spec = appendUleb(spec, uint64(a.form))
+		}
+
+		key := abbrevKey{tag: d.tag, children: len(d.children) > 0, attrs: string(spec)}
+		code, ok := codes[key]
+		if !ok {
+			code = uint64(len(codes) + 1)
+			codes[key] = code
+
+			abbrev.uleb(code)
+			abbrev.uleb(uint64(d.tag))
+			if key.children {
+				abbrev.u8(1)
+			} else {
+				abbrev.u8(0)
+			}
+			abbrev.Write(spec)
+			abbrev.u8(0)
+			abbrev.u8(0)
+		}
+		d.code = code
+
+		for _, c := range d.children {
+			assign(c)
+		}
+	}
+
+	for _, u := range units {
+		assign(u)
+	}
+	abbrev.u8(0)
+
+	info := t.newDwarfBuf()
+	for _, u := range units {
+		// unit_length + version + debug_abbrev_offset + address_size
+		end := t.layout(u, 11)
+
+		info.u32(end - 4)
+		info.u16(dwarfVersion)
+		info.u32(0)
+		info.u8(uint8(info.addrSize))
+		info.writeDie(u)
+	}
+
+	return abbrev.Bytes(), info.Bytes()
+}
+
+// layout assigns unit-relative offsets to d and its children, returns offset after d.
+func (t *TinyELF) layout(d *die, off uint32) uint32 {
+	d.offset = off
+	off += uint32(len(appendUleb(nil, d.code)))
+
+	for _, a := range d.attrs {
+		switch a.form {
+		case formAddr:
+			off += uint32(t.addrSize())
+		case formData1, formFlag:
+			off++
+		case formData2:
+			off += 2
+		case formData4, formRef4, formSecOffset:
+			off += 4
+		case formData8:
+			off += 8
+		case formString:
+			off += uint32(len(a.value.(string)) + 1)
+		case formUdata:
+			off += uint32(len(appendUleb(nil, a.value.(uint64))))
+		case formSdata:
+			off += uint32(len(appendSleb(nil, a.value.(int64))))
+		case formExprloc:
+			l := len(a.value.([]byte))
+			off += uint32(len(appendUleb(nil, uint64(l))) + l)
+		case formFlagPresent:
+		}
+	}
+
+	if len(d.children) == 0 {
+		return off
+	}
+
+	for _, c := range d.children {
+		off = t.layout(c, off)
+	}
+
+	return off + 1
+}
+
+func (b *dwarfBuf) writeDie(d *die) {
+	b.uleb(d.code)
+
+	for _, a := range d.attrs {
+		switch a.form {
+		case formAddr:
+			b.addr(a.value.(uint64))
+		case formData1:
+			b.u8(uint8(a.value.(uint64)))
+		case formFlag:
+			if a.value.(bool) {
+				b.u8(1)
+			} else {
+				b.u8(0)
+			}
+		case formData2:
+			b.u16(uint16(a.value.(uint64)))
+		case formData4, formSecOffset:
+			b.u32(uint32(a.value.(uint64)))
+		case formData8:
+			b.u64(a.value.(uint64))
+		case formRef4:
+			b.u32(a.value.(*die).offset)
+		case formString:
+			b.str(a.value.(string))
+		case formUdata:
+			b.uleb(a.value.(uint64))
+		case formSdata:
+			b.sleb(a.value.(int64))
+		case formExprloc:
+			e := a.value.([]byte)
+			b.uleb(uint64(len(e)))
+			b.Write(e)
+		case formFlagPresent:
+		}
+	}
+
+	if len(d.children) == 0 {
+		return
+	}
+
+	for _, c := range d.children {
+		b.writeDie(c)
+	}
+	b.u8(0)
+}
@@ -0,0 +1,170 @@
+package tinyelf
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+)
+
+// newFile returns ELF of given class and byte order with debug info of one function, global and source file.
+func newFile(class elf.Class, order binary.ByteOrder) *TinyELF {
+	machines := map[elf.Class]map[binary.ByteOrder]elf.Machine{
+		elf.ELFCLASS32: {binary.LittleEndian: elf.EM_ARM, binary.BigEndian: elf.EM_MIPS},
+		elf.ELFCLASS64: {binary.LittleEndian: elf.EM_X86_64, binary.BigEndian: elf.EM_PPC64},
+	}
+
+	var e *TinyELF
+	if class == elf.ELFCLASS32 {
+		e = New32("", machines[class][order], 0, order, uint(elf.ET_EXEC))
+	} else {
+		e = New64("", machines[class][order], 0, order, uint(elf.ET_EXEC))
+	}
+
+	u32 := &Type{Kind: KindBase, Name: "uint", Size: 4, Encoding: EncodingUnsigned}
+	pair := &Type{Kind: KindStruct, Name: "pair", Size: 8, Members: []*Member{{Name: "first", Type: u32}, {Name: "second", Type: u32, Offset: 4}}}
+
+	e.AddSymbol("main", 0x1000, 0x20, elf.STT_FUNC)
+	e.AddFunction(&Function{
+		Name: "main", LowPC: 0x1000, HighPC: 0x1020, FrameBase: FrameBaseCFA,
+		Params: []*Variable{{Name: "argc", Type: u32, Location: LocRegister(0)}},
+		Locals: []*Variable{{Name: "local_10", Type: &Type{Kind: KindPointer, Size: 4, Target: pair}, Location: LocFrameBase(-0x10)}},
+	})
+	e.AddGlobal(&Global{Name: "counter", Address: 0x2000, Type: pair})
+	e.AddSource(&Source{Path: "/src/fw.c", Sequences: []LineSequence{{
+		Rows: []LineRow{{Address: 0x1000, Line: 1}, {Address: 0x1008, Line: 3}, {Address: 0x1018, Line: 2}},
+		End:  0x1020,
+	}}})
+
+	return e
+}
+
+func TestDWARF(t *testing.T) {
+	for _, class := range []elf.Class{elf.ELFCLASS32, elf.ELFCLASS64} {
+		for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+			name := class.String() + " " + order.String()
+			f := parse(t, newFile(class, order))
+			if f.Class != class || f.ByteOrder != order {
+				t.Fatalf("%s: got %s %s", name, f.Class, f.ByteOrder)
+			}
+
+			d, err := f.DWARF()
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+
+			checkEntries(t, name, d)
+			checkLines(t, name, d)
+		}
+	}
+}
+
+func checkEntries(t *testing.T, name string, d *dwarf.Data) {
+	entries := map[string]*dwarf.Entry{}
+	r := d.Reader()
+	for {
+		e, err := r.Next()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if e == nil {
+			break
+		}
+
+		if n, ok := e.Val(dwarf.AttrName).(string); ok {
+			entries[n] = e
+		}
+	}
+
+	main := entries["main"]
+	if main == nil || main.Tag != dwarf.TagSubprogram {
+		t.Fatalf("%s: got main %+v", name, main)
+	}
+
+	low, _ := main.Val(dwarf.AttrLowpc).(uint64)
+	// DWARF 4 high pc is offset from low pc
+	high, _ := main.Val(dwarf.AttrHighpc).(int64)
+	if low != 0x1000 || high != 0x20 {
+		t.Errorf("%s: main pc: got 0x%x+0x%x", name, low, high)
+	}
+
+	if fb, _ := main.Val(dwarf.AttrFrameBase).([]byte); !bytes.Equal(fb, FrameBaseCFA) {
+		t.Errorf("%s: main frame base: got %x", name, fb)
+	}
+
+	locations := map[string][]byte{"argc": {0x50}, "local_10": {0x91, 0x70}}
+	for v, want := range locations {
+		e := entries[v]
+		if e == nil {
+			t.Errorf("%s: no %s", name, v)
+			continue
+		}
+
+		if got, _ := e.Val(dwarf.AttrLocation).([]byte); !bytes.Equal(got, want) {
+			t.Errorf("%s: %s location: got %x, want %x", name, v, got, want)
+		}
+	}
+
+	if tag := entries["argc"].Tag; tag != dwarf.TagFormalParameter {
+		t.Errorf("%s: argc: got %s", name, tag)
+	}
+
+	counter := entries["counter"]
+	if counter == nil {
+		t.Fatalf("%s: no counter", name)
+	}
+
+	typ, err := d.Type(counter.Val(dwarf.AttrType).(dwarf.Offset))
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+
+	st, ok := typ.(*dwarf.StructType)
+	if !ok || st.StructName != "pair" || st.ByteSize != 8 || len(st.Field) != 2 ||
+		st.Field[1].Name != "second" || st.Field[1].ByteOffset != 4 || st.Field[1].Type.Size() != 4 {
+		t.Errorf("%s: counter type: got %s", name, typ)
+	}
+}
+
+func checkLines(t *testing.T, name string, d *dwarf.Data) {
+	r := d.Reader()
+	rows := []dwarf.LineEntry{}
+	for {
+		cu, err := r.Next()
+		if err != nil || cu == nil {
+			break
+		}
+
+		lr, err := d.LineReader(cu)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		r.SkipChildren()
+
+		if lr == nil {
+			continue
+		}
+
+		e := dwarf.LineEntry{}
+		for lr.Next(&e) == nil {
+			rows = append(rows, e)
+		}
+	}
+
+	want := []struct {
+		addr uint64
+		line int
+		end  bool
+	}{{0x1000, 1, false}, {0x1008, 3, false}, {0x1018, 2, false}, {0x1020, 2, true}}
+	if len(rows) != len(want) {
+		t.Fatalf("%s: got %d line rows, want %d", name, len(rows), len(want))
+	}
+
+	for i, w := range want {
+		if rows[i].Address != w.addr || rows[i].Line != w.line || rows[i].EndSequence != w.end || rows[i].File.Name != "/src/fw.c" {
+			t.Errorf("%s: row %d: got 0x%x line %d end %v file %s", name, i, rows[i].Address, rows[i].Line, rows[i].EndSequence, rows[i].File.Name)
+		}
+	}
+}
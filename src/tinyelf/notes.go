@@ -0,0 +1,64 @@
+package tinyelf
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"debug/elf"
+	"encoding/binary"
+)
+
+// NT_GNU_BUILD_ID note type.
+const ntGNUBuildID = 3
+
+// AddNote adds SHT_NOTE section with a single note and returns it.
+func (t *TinyELF) AddNote(section string, name string, typ uint32, desc []byte) *Section {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, t.byteOrder, uint32(len(name)+1))
+	binary.Write(buf, t.byteOrder, uint32(len(desc)))
+	binary.Write(buf, t.byteOrder, typ)
+	buf.WriteString(name + "\x00")
+	buf.Write(make([]byte, (4-buf.Len()%4)%4))
+	buf.Write(desc)
+	buf.Write(make([]byte, (4-buf.Len()%4)%4))
+
+	s := &Section{Name: section, Type: elf.SHT_NOTE, Data: buf.Bytes(), Addralign: 4}
+	t.AddSection(s)
+
+	return s
+}
+
+// SetBuildID adds .note.gnu.build-id with id, nil id is computed as SHA-1 of the file contents.
+func (t *TinyELF) SetBuildID(id []byte) {
+	if id == nil {
+		t.buildID = t.AddNote(".note.gnu.build-id", "GNU", ntGNUBuildID, make([]byte, sha1.Size))
+		return
+	}
+
+	t.AddNote(".note.gnu.build-id", "GNU", ntGNUBuildID, id)
+}
+
+// SetDebugLink adds .gnu_debuglink with name of separate debug file and CRC32 of its contents.
+func (t *TinyELF) SetDebugLink(name string, crc uint32) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(name + "\x00")
+	buf.Write(make([]byte, (4-buf.Len()%4)%4))
+	binary.Write(buf, t.byteOrder, crc)
+
+	t.AddSection(&Section{Name: ".gnu_debuglink", Type: elf.SHT_PROGBITS, Data: buf.Bytes(), Addralign: 4})
+}
+
+// computeBuildID fills build-id note added by SetBuildID(nil) with hash of the file with zero build-id.
+func (t *TinyELF) computeBuildID() error {
+	desc := t.buildID.Data[len(t.buildID.Data)-sha1.Size:]
+	clear(desc)
+
+	data, err := t.bytes()
+	if err != nil {
+		return err
+	}
+
+	sum := sha1.Sum(data)
+	copy(desc, sum[:])
+
+	return nil
+}
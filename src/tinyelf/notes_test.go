@@ -0,0 +1,110 @@
+package tinyelf
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"debug/elf"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+func sectionData(t *testing.T, f *elf.File, name string) (*elf.Section, []byte) {
+	s := f.Section(name)
+	if s == nil {
+		t.Fatalf("no %s section", name)
+	}
+
+	data, err := s.Data()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, data
+}
+
+func TestAddNote(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		e := New32("", elf.EM_ARM, 0, order, uint(elf.ET_EXEC))
+		e.AddNote(".note.decompelf", "decompelf", 1, []byte("program=fw\n"))
+
+		s, got := sectionData(t, parse(t, e), ".note.decompelf")
+
+		// name and descriptor are padded to 4 bytes
+		want := &bytes.Buffer{}
+		binary.Write(want, order, []uint32{10, 11, 1})
+		want.WriteString("decompelf\x00\x00\x00")
+		want.WriteString("program=fw\n\x00")
+		if s.Type != elf.SHT_NOTE || s.Addralign != 4 || !bytes.Equal(got, want.Bytes()) {
+			t.Errorf("%s: got %s %x, want %x", order, s.Type, got, want.Bytes())
+		}
+	}
+}
+
+func TestBuildID(t *testing.T) {
+	e := New64("", elf.EM_X86_64, 0, binary.LittleEndian, uint(elf.ET_EXEC))
+	e.AddSymbol("main", 0x1000, 0x10, elf.STT_FUNC)
+	e.SetBuildID(nil)
+
+	data, err := e.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, note := sectionData(t, f, ".note.gnu.build-id")
+	if binary.LittleEndian.Uint32(note[4:]) != sha1.Size || binary.LittleEndian.Uint32(note[8:]) != ntGNUBuildID || string(note[12:16]) != "GNU\x00" {
+		t.Fatalf("got note header %x", note[:16])
+	}
+
+	// build-id is SHA-1 of the file with zero build-id
+	zeroed := bytes.Clone(data)
+	clear(zeroed[s.Offset+16 : s.Offset+16+sha1.Size])
+	want := sha1.Sum(zeroed)
+	if !bytes.Equal(note[16:], want[:]) {
+		t.Errorf("got build-id %x, want %x", note[16:], want)
+	}
+
+	again, _ := e.Bytes()
+	if !bytes.Equal(data, again) {
+		t.Errorf("build-id is not reproducible")
+	}
+
+	e = New64("", elf.EM_X86_64, 0, binary.LittleEndian, uint(elf.ET_EXEC))
+	e.SetBuildID([]byte{1, 2, 3, 4, 5})
+	if _, note = sectionData(t, parse(t, e), ".note.gnu.build-id"); !bytes.Equal(note[16:], []byte{1, 2, 3, 4, 5, 0, 0, 0}) {
+		t.Errorf("got explicit build-id %x", note[16:])
+	}
+}
+
+func TestDebugLink(t *testing.T) {
+	contents := []byte("separate debug file")
+	crc := crc32.ChecksumIEEE(contents)
+
+	tests := []struct {
+		name string
+		// bytes before CRC
+		want string
+	}{
+		{"fw.debug", "fw.debug\x00\x00\x00\x00"},
+		{"a.dbg", "a.dbg\x00\x00\x00"},
+		{"abc", "abc\x00"},
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		for _, tt := range tests {
+			e := New32("", elf.EM_MIPS, 0, order, uint(elf.ET_EXEC))
+			e.SetDebugLink(tt.name, crc)
+
+			want := bytes.NewBufferString(tt.want)
+			binary.Write(want, order, crc)
+			if s, got := sectionData(t, parse(t, e), ".gnu_debuglink"); s.Addralign != 4 || !bytes.Equal(got, want.Bytes()) {
+				t.Errorf("%s %s: got %x, want %x", order, tt.name, got, want.Bytes())
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package tinyelf
+
+import (
+	"debug/elf"
+	"sort"
+)
+
+// Overlap is a pair of symbols of one section with intersecting extents.
+type Overlap struct {
+	Section string
+	First   Symbol
+	Second  Symbol
+}
+
+// InferSizes sets size of symbols with zero size to distance to the next symbol of the same section,
+// the last one gets the rest of the section if section size is known. Functions without size get the same high pc.
+// Returns symbols which overlap after inference.
+func (t *TinyELF) InferSizes() []Overlap {
+	return t.checkSizes(true)
+}
+
+// Overlaps returns symbols of the same section with intersecting extents.
+func (t *TinyELF) Overlaps() []Overlap {
+	return t.checkSizes(false)
+}
+
+func (t *TinyELF) checkSizes(infer bool) []Overlap {
+	sections, placed := t.assignSections()
+
+	bySection := make([][]*Symbol, len(sections))
+	for i, sym := range t.symbols {
+		if placed[i] >= 0 {
+			bySection[placed[i]] = append(bySection[placed[i]], sym)
+		}
+	}
+
+	inferred := map[uint64]uint64{}
+	result := []Overlap{}
+	for i, symbols := range bySection {
+		sort.SliceStable(symbols, func(a, b int) bool { return symbols[a].Value < symbols[b].Value })
+
+		end := sections[i].Addr + sections[i].size()
+		if sections[i].size() == 0 {
+			end = 0
+		}
+
+		if infer {
+			next := end
+			for j := len(symbols) - 1; j >= 0; j-- {
+				sym := symbols[j]
+				if sym.Size == 0 && next > sym.Value {
+					sym.Size = next - sym.Value
+					if sym.Type == elf.STT_FUNC {
+						inferred[sym.Value] = sym.Size
+					}
+				}
+
+				if j > 0 && symbols[j-1].Value < sym.Value {
+					next = sym.Value
+				}
+			}
+		}
+
+		var last *Symbol
+		for _, sym := range symbols {
+			if sym.Size == 0 {
+				continue
+			}
+
+			if last != nil && last.Value+last.Size > sym.Value {
+				result = append(result, Overlap{Section: sections[i].Name, First: *last, Second: *sym})
+			}
+
+			if last == nil || sym.Value+sym.Size > last.Value+last.Size {
+				last = sym
+			}
+		}
+	}
+
+	for _, f := range t.functions {
+		if size, ok := inferred[f.LowPC]; ok && f.HighPC <= f.LowPC {
+			f.HighPC = f.LowPC + size
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,86 @@
+package tinyelf
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+)
+
+func sizes(e *TinyELF) map[string]uint64 {
+	result := map[string]uint64{}
+	for _, s := range e.symbols {
+		result[s.Name] = s.Size
+	}
+
+	return result
+}
+
+func TestInferSizes(t *testing.T) {
+	e := New64("", elf.EM_X86_64, 0, binary.LittleEndian, uint(elf.ET_EXEC))
+	e.AddSection(&Section{Name: ".bss", Type: elf.SHT_NOBITS, Flags: elf.SHF_ALLOC | elf.SHF_WRITE, Addr: 0x2000, Size: 0x100})
+
+	// .text has no size, the last function keeps zero size
+	e.AddSymbol("f1", 0x1000, 0, elf.STT_FUNC)
+	e.AddSymbol("f2", 0x1010, 0, elf.STT_FUNC)
+	e.AddFunction(&Function{Name: "f1", LowPC: 0x1000, HighPC: 0x1000})
+	// no gap after sized symbol
+	e.AddSymbol("a", 0x2000, 0x10, elf.STT_OBJECT)
+	// aliases get the same size and share addresses
+	e.AddSymbol("b", 0x2010, 0, elf.STT_OBJECT)
+	e.AddSymbol("b_alias", 0x2010, 0, elf.STT_OBJECT)
+	// the last one gets the rest of section
+	e.AddSymbol("c", 0x2040, 0, elf.STT_OBJECT)
+	// outside of any section, new .data has no size
+	e.AddSymbol("far1", 0x9000, 0, elf.STT_OBJECT)
+	e.AddSymbol("far2", 0x9008, 0, elf.STT_OBJECT)
+
+	if overlaps := e.InferSizes(); len(overlaps) != 1 || overlaps[0].First.Name != "b" || overlaps[0].Second.Name != "b_alias" {
+		t.Errorf("got overlaps %+v", overlaps)
+	}
+
+	want := map[string]uint64{"f1": 0x10, "f2": 0, "a": 0x10, "b": 0x30, "b_alias": 0x30, "c": 0xc0, "far1": 8, "far2": 0}
+	got := sizes(e)
+	for name, size := range want {
+		if got[name] != size {
+			t.Errorf("%s: got size 0x%x, want 0x%x", name, got[name], size)
+		}
+	}
+
+	if f := e.functions[0]; f.HighPC != 0x1010 {
+		t.Errorf("f1 high pc: got 0x%x, want 0x1010", f.HighPC)
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	e := New64("", elf.EM_X86_64, 0, binary.LittleEndian, uint(elf.ET_EXEC))
+	e.AddSection(&Section{Name: ".data", Type: elf.SHT_NOBITS, Flags: elf.SHF_ALLOC | elf.SHF_WRITE, Addr: 0x2000, Size: 0x100})
+	e.AddSection(&Section{Name: ".rodata", Type: elf.SHT_NOBITS, Flags: elf.SHF_ALLOC, Addr: 0x3000, Size: 0x100})
+	e.AddSymbol("big", 0x2000, 0x20, elf.STT_OBJECT)
+	e.AddSymbol("inner", 0x2010, 8, elf.STT_OBJECT)
+	// adjacent symbols do not overlap
+	e.AddSymbol("next", 0x2020, 8, elf.STT_OBJECT)
+	// unknown sizes are not reported
+	e.AddSymbol("label", 0x2004, 0, elf.STT_OBJECT)
+	// symbols of other section
+	e.AddSymbol("ro1", 0x3000, 0x10, elf.STT_OBJECT)
+	e.AddSymbol("ro2", 0x3010, 0x10, elf.STT_OBJECT)
+
+	overlaps := e.Overlaps()
+	if len(overlaps) != 1 || overlaps[0].Section != ".data" || overlaps[0].First.Name != "big" || overlaps[0].Second.Name != "inner" {
+		t.Errorf("got %+v", overlaps)
+	}
+
+	// sizes are not changed
+	if got := sizes(e); got["label"] != 0 {
+		t.Errorf("label: got size 0x%x", got["label"])
+	}
+
+	// label inside of big gets size up to the next symbol
+	if overlaps = e.InferSizes(); len(overlaps) != 2 || overlaps[0].Second.Name != "label" || overlaps[1].Second.Name != "inner" {
+		t.Errorf("after inference: got %+v", overlaps)
+	}
+
+	if got := sizes(e); got["label"] != 0xc {
+		t.Errorf("label: got size 0x%x, want 0xc", got["label"])
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"os"
+	"slices"
 )
 
 var ErrNoELF = errors.New("no elf data")
@@ -22,21 +23,15 @@ func (s *StrTab) Append(name string) (index uint32) {
 
 type elf32 struct {
 	Header    elf.Header32
-	SymTab    []byte
-	StrTab    StrTab
 	ShStrTab  []byte
 	Sections  []elf.Section32
-	symbuf    *bytes.Buffer
 	byteOrder binary.ByteOrder
 }
 
 type elf64 struct {
 	Header    elf.Header64
-	SymTab    []byte
-	StrTab    StrTab
 	ShStrTab  []byte
 	Sections  []elf.Section64
-	symbuf    *bytes.Buffer
 	byteOrder binary.ByteOrder
 }
 
@@ -46,6 +41,164 @@ type TinyELF struct {
 	elf64     *elf64
 	byteOrder binary.ByteOrder
 	filename  string
+	text      *Section
+	sections  []*Section
+	symbols   []*Symbol
+	segments  []*Segment
+	sources   []*Source
+	functions []*Function
+	globals   []*Global
+	slide     uint64
+	// buildID is build-id note computed by Bytes
+	buildID *Section
+}
+
+// Symbol is a symbol table entry. It is placed into allocated section holding its value if Section is zero,
+// functions prefer executable sections, objects prefer data ones.
+type Symbol struct {
+	Name       string
+	Value      uint64
+	Size       uint64
+	Type       elf.SymType
+	Bind       elf.SymBind
+	Visibility elf.SymVis
+	Section    uint16 // index returned by AddSection, 1 for .text or special index like SHN_ABS
+}
+
+// Section is an additional section placed after .shstrtab.
+// Allocated sections without data get SHT_NOBITS type and are grown to cover their symbols.
+type Section struct {
+	Name      string
+	Type      elf.SectionType
+	Flags     elf.SectionFlag
+	Addr      uint64
+	Data      []byte
+	Size      uint64 // SHT_NOBITS only, len(Data) is used otherwise
+	Link      uint32
+	Info      uint32
+	Addralign uint64
+	Entsize   uint64
+}
+
+func (s *Section) size() uint64 {
+	if s.Type == elf.SHT_NOBITS {
+		return s.Size
+	}
+
+	return uint64(len(s.Data))
+}
+
+func (s *Section) contains(addr uint64) bool {
+	return s.Flags&elf.SHF_ALLOC != 0 && addr >= s.Addr && addr < s.Addr+s.size()
+}
+
+// cover grows SHT_NOBITS section to hold [low, high).
+func (s *Section) cover(low uint64, high uint64) {
+	if s.Type != elf.SHT_NOBITS {
+		return
+	}
+
+	end := s.Addr + s.Size
+	if s.Size == 0 && s.Addr == 0 {
+		s.Addr, end = low, high
+	}
+
+	s.Addr = min(s.Addr, low)
+	s.Size = max(end, high) - s.Addr
+}
+
+// Segment is a PT_LOAD segment, allocated sections inside of it get its bytes.
+type Segment struct {
+	Addr    uint64
+	Data    []byte
+	MemSize uint64 // len(Data) if smaller
+	Flags   elf.ProgFlag
+	Align   uint64 // 0x1000 if zero
+}
+
+// AddSegment adds loadable segment s, segments must not overlap.
+func (t *TinyELF) AddSegment(s *Segment) {
+	t.segments = append(t.segments, s)
+}
+
+// SetEntry sets entry point address.
+func (t *TinyELF) SetEntry(addr uint64) {
+	if t.elf32 != nil {
+		t.elf32.Header.Entry = uint32(addr)
+	}
+
+	if t.elf64 != nil {
+		t.elf64.Header.Entry = addr
+	}
+}
+
+// segmentOf returns index of segment with file bytes for [addr, addr+size), -1 if there is none.
+func segmentOf(segments []*Segment, addr uint64, size uint64) int {
+	for i, seg := range segments {
+		if size > 0 && addr >= seg.Addr && addr+size <= seg.Addr+uint64(len(seg.Data)) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// inSegment returns index of segment holding bytes of allocated section s and offset of s in it.
+func inSegment(segments []*Segment, s *Section) (int, uint64) {
+	if s.Flags&elf.SHF_ALLOC == 0 || s.Type == elf.SHT_NOBITS {
+		return -1, 0
+	}
+
+	i := segmentOf(segments, s.Addr, s.size())
+	if i < 0 {
+		return -1, 0
+	}
+
+	off := s.Addr - segments[i].Addr
+	if !bytes.Equal(s.Data, segments[i].Data[off:off+s.size()]) {
+		return -1, 0
+	}
+
+	return i, off
+}
+
+func (s *Segment) memSize() uint64 {
+	return max(s.MemSize, uint64(len(s.Data)))
+}
+
+func (s *Segment) align() uint64 {
+	if s.Align == 0 {
+		return 0x1000
+	}
+
+	return s.Align
+}
+
+// base sections: null, .text, .symtab, .strtab, .shstrtab
+const baseSections = 5
+
+// AddSection adds section s and returns its index, section named .text replaces the default one.
+// s may be modified until Write is called.
+func (t *TinyELF) AddSection(s *Section) uint16 {
+	if s.Name == ".text" {
+		t.text = s
+		return 1
+	}
+
+	t.sections = append(t.sections, s)
+
+	return uint16(baseSections + len(t.sections) - 1)
+}
+
+// HasSection reports whether section with name was added.
+func (t *TinyELF) HasSection(name string) bool {
+	for _, s := range t.sections {
+		if s.Name == name {
+			return true
+		}
+	}
+
+	return false
 }
 
 var IDENT32 = [16]byte{0x7f, 'E', 'L', 'F', 0x01, 0x01, 0x01, 0, 0, 0, 0, 0, 0, 0, 0, 0}
@@ -69,12 +222,8 @@ func New32(filename string, machine elf.Machine, flags uint32, byteOrder binary.
 	}
 
 	textSection := elf.Section32{
-		Name:      1,
-		Type:      uint32(elf.SHT_PROGBITS),
-		Flags:     uint32(elf.SHF_ALLOC | elf.SHF_EXECINSTR), // AX = 6
-		Off:       uint32(header.Ehsize),
-		Size:      0,
-		Addralign: 4,
+		Name: 1,
+		Off:  uint32(header.Ehsize),
 	}
 
 	symtabSection := elf.Section32{
@@ -105,90 +254,78 @@ func New32(filename string, machine elf.Machine, flags uint32, byteOrder binary.
 
 	e := &elf32{
 		Header:    header,
-		SymTab:    []byte{},
-		StrTab:    []byte{},
 		ShStrTab:  shstrtab,
 		Sections:  []elf.Section32{elf.Section32{}, textSection, symtabSection, strtabSection, shStrTabSection},
-		symbuf:    new(bytes.Buffer),
 		byteOrder: byteOrder,
 	}
 
-	e.AddSymbol("", 0x0, 0, elf.STT_FUNC)
-	e.Sections[2].Info = 1
-
 	t := &TinyELF{
 		elf32:     e,
 		filename:  filename,
 		byteOrder: byteOrder,
+		text:      newText(),
 	}
 
 	return t
 }
 
-func (e *elf32) AddSymbol(name string, value int, size int, symType elf.SymType) {
-	index := e.StrTab.Append(name)
-
-	symbol := elf.Sym32{
-		Name:  index,
-		Value: uint32(value),
-	}
+// Rebase relocates symbols and debug info added after the call by slide, base is decompiler image base.
+// Symbol values of ET_REL files are relative to their sections, .text gets base+slide address,
+// so gdb add-symbol-file -o moves them together with debug info.
+func (t *TinyELF) Rebase(base uint64, slide uint64) {
+	t.slide = slide
 
-	if value != 0x0 {
-		symbol.Info = uint8(elf.STB_GLOBAL<<4) + uint8(symType&0xf) // 18
-		symbol.Size = uint32(size)
-		symbol.Shndx = 1
-		symbol.Other = 0
+	if t.elfType() == elf.ET_REL {
+		t.text.Addr = base + slide
 	}
-
-	binary.Write(e.symbuf, e.byteOrder, symbol)
-	e.SymTab = append(e.SymTab, e.symbuf.Bytes()...)
-
-	e.Sections[2].Size += uint32(len(e.symbuf.Bytes()))
-	e.Sections[3].Off += uint32(len(e.symbuf.Bytes()))
-
-	e.Sections[3].Size = uint32(len(e.StrTab))
-	e.Sections[4].Off = e.Sections[3].Off + e.Sections[3].Size
-
-	e.symbuf.Reset()
 }
 
-func (e *elf64) AddSymbol(name string, value int, size int, symType elf.SymType) {
-	index := e.StrTab.Append(name)
+// AddSymbol adds global symbol with default visibility.
+func (t *TinyELF) AddSymbol(name string, value uint64, size uint64, symType elf.SymType) {
+	t.AddSymbolEntry(&Symbol{Name: name, Value: value, Size: size, Type: symType, Bind: elf.STB_GLOBAL})
+}
 
-	symbol := elf.Sym64{
-		Name:  index,
-		Value: uint64(value),
-	}
+// AddSymbolEntry adds symbol s, local symbols are written before others regardless of order of calls.
+func (t *TinyELF) AddSymbolEntry(s *Symbol) {
+	rebased := *s
+	rebased.Value += t.slide
+	t.symbols = append(t.symbols, &rebased)
+}
 
-	if value != 0x0 {
-		symbol.Info = uint8(elf.STB_GLOBAL<<4) + uint8(symType&0xf) // 18
-		symbol.Size = uint64(size)
-		symbol.Shndx = 1
-		symbol.Other = 0
+// Retain removes symbols for which keep returns false together with DWARF functions and globals at their addresses.
+// Symbol values passed to keep are rebased.
+func (t *TinyELF) Retain(keep func(s *Symbol) bool) {
+	functions := map[uint64]bool{}
+	objects := map[uint64]bool{}
+	symbols := []*Symbol{}
+	for _, s := range t.symbols {
+		if !keep(s) {
+			continue
+		}
+
+		symbols = append(symbols, s)
+		if s.Type == elf.STT_FUNC {
+			functions[s.Value] = true
+		} else {
+			objects[s.Value] = true
+		}
 	}
+	t.symbols = symbols
 
-	binary.Write(e.symbuf, e.byteOrder, symbol)
-	e.SymTab = append(e.SymTab, e.symbuf.Bytes()...)
-
-	e.Sections[2].Size += uint64(len(e.symbuf.Bytes()))
-	e.Sections[3].Off += uint64(len(e.symbuf.Bytes()))
-
-	e.Sections[3].Size = uint64(len(e.StrTab))
-	e.Sections[4].Off = e.Sections[3].Off + e.Sections[3].Size
-
-	e.symbuf.Reset()
+	t.functions = slices.DeleteFunc(t.functions, func(f *Function) bool { return !functions[f.LowPC] })
+	t.globals = slices.DeleteFunc(t.globals, func(g *Global) bool { return !objects[g.Address] })
 }
 
-func (t *TinyELF) AddSymbol(name string, value int, size int, symType elf.SymType) {
+func (t *TinyELF) elfType() elf.Type {
 	if t.elf32 != nil {
-		t.elf32.AddSymbol(name, value, size, symType)
-		return
+		return elf.Type(t.elf32.Header.Type)
 	}
 
-	if t.elf64 != nil {
-		t.elf64.AddSymbol(name, value, size, symType)
-		return
-	}
+	return elf.Type(t.elf64.Header.Type)
+}
+
+func newText() *Section {
+	return &Section{Name: ".text", Type: elf.SHT_NOBITS, Flags: elf.SHF_ALLOC | elf.SHF_EXECINSTR, Addralign: 4}
 }
 
 func New64(filename string, machine elf.Machine, flags uint32, byteOrder binary.ByteOrder, elfType uint) *TinyELF {
@@ -209,12 +346,8 @@ func New64(filename string, machine elf.Machine, flags uint32, byteOrder binary.
 	}
 
 	textSection := elf.Section64{
-		Name:      1,
-		Type:      uint32(elf.SHT_PROGBITS),
-		Flags:     uint64(elf.SHF_ALLOC | elf.SHF_EXECINSTR), // AX = 6
-		Off:       uint64(header.Ehsize),
-		Size:      0,
-		Addralign: 4,
+		Name: 1,
+		Off:  uint64(header.Ehsize),
 	}
 
 	symtabSection := elf.Section64{
@@ -245,58 +378,471 @@ func New64(filename string, machine elf.Machine, flags uint32, byteOrder binary.
 
 	e := &elf64{
 		Header:    header,
-		SymTab:    []byte{},
-		StrTab:    []byte{},
 		ShStrTab:  shstrtab,
 		Sections:  []elf.Section64{elf.Section64{}, textSection, symtabSection, strtabSection, shStrTabSection},
-		symbuf:    new(bytes.Buffer),
 		byteOrder: byteOrder,
 	}
 
-	e.AddSymbol("", 0x0, 0, elf.STT_FUNC)
-	e.Sections[2].Info = 1
-
 	t := &TinyELF{
 		elf64:     e,
 		filename:  filename,
 		byteOrder: byteOrder,
+		text:      newText(),
 	}
 
 	return t
 }
 
 func (t *TinyELF) Write() error {
+	data, err := t.Bytes()
+	if err != nil {
+		return err
+	}
+
+	// sources are replaced atomically, gdb may read them while file is regenerated
+	for _, src := range t.sources {
+		if err = os.WriteFile(src.Path+".tmp", src.Text, 0644); err != nil {
+			return err
+		}
+
+		if err = os.Rename(src.Path+".tmp", src.Path); err != nil {
+			return err
+		}
+	}
+
 	f, err := os.OpenFile(t.filename, os.O_RDWR|os.O_CREATE, 0600)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
 
 	err = f.Truncate(0)
 	if err != nil {
 		return err
 	}
 
+	_, err = f.Write(data)
+
+	return err
+}
+
+// Bytes returns ELF file contents.
+func (t *TinyELF) Bytes() ([]byte, error) {
+	if t.buildID != nil {
+		if err := t.computeBuildID(); err != nil {
+			return nil, err
+		}
+	}
+
+	return t.bytes()
+}
+
+func (t *TinyELF) bytes() ([]byte, error) {
+	if t.elf32 == nil && t.elf64 == nil {
+		return nil, ErrNoELF
+	}
+
+	text, extra, symbols := t.placeSymbols()
+	if len(t.sources) > 0 || len(t.functions) > 0 || len(t.globals) > 0 {
+		dw, err := t.dwarfSections()
+		if err != nil {
+			return nil, err
+		}
+		extra = append(extra, dw...)
+	}
+
+	buf := &bytes.Buffer{}
+
 	if t.elf32 != nil {
-		t.elf32.Header.Shoff = t.elf32.Sections[4].Off + t.elf32.Sections[4].Size
-		binary.Write(f, t.byteOrder, t.elf32.Header)
-		binary.Write(f, t.byteOrder, t.elf32.SymTab)
-		binary.Write(f, t.byteOrder, t.elf32.StrTab)
-		binary.Write(f, t.byteOrder, t.elf32.ShStrTab)
-		binary.Write(f, t.byteOrder, t.elf32.Sections)
+		t.elf32.write(buf, text, symbols, extra, t.segments)
+	} else {
+		t.elf64.write(buf, text, symbols, extra, t.segments)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// symbol is a symbol table entry with resolved section and value.
+type symbol struct {
+	name  uint32
+	value uint64
+	size  uint64
+	info  uint8
+	other uint8
+	shndx uint16
+}
+
+// symbolTable is a symbol table starting with null symbol, locals go first.
+type symbolTable struct {
+	symbols []symbol
+	strtab  StrTab
+	// firstGlobal is sh_info of .symtab
+	firstGlobal uint32
+}
 
-		return nil
+// placeSymbols places symbols into copies of .text and added sections, objects outside of them go to new .data section.
+// Sections inside of segments get their bytes. Returns .text, added sections and symbol table.
+func (t *TinyELF) placeSymbols() (*Section, []*Section, *symbolTable) {
+	sections, placed := t.assignSections()
+
+	for i, sym := range t.symbols {
+		if placed[i] >= 0 {
+			sections[placed[i]].cover(sym.Value, sym.Value+max(sym.Size, 1))
+		}
 	}
 
-	if t.elf64 != nil {
-		t.elf64.Header.Shoff = t.elf64.Sections[4].Off + t.elf64.Sections[4].Size
-		binary.Write(f, t.byteOrder, t.elf64.Header)
-		binary.Write(f, t.byteOrder, t.elf64.SymTab)
-		binary.Write(f, t.byteOrder, t.elf64.StrTab)
-		binary.Write(f, t.byteOrder, t.elf64.ShStrTab)
-		binary.Write(f, t.byteOrder, t.elf64.Sections)
+	for _, s := range sections {
+		if s.Type != elf.SHT_NOBITS || s.Flags&elf.SHF_ALLOC == 0 {
+			continue
+		}
+
+		if i := segmentOf(t.segments, s.Addr, s.Size); i >= 0 {
+			off := s.Addr - t.segments[i].Addr
+			s.Type = elf.SHT_PROGBITS
+			s.Data = t.segments[i].Data[off : off+s.Size]
+		}
+	}
+
+	table := &symbolTable{}
+	locals := []symbol{{name: table.strtab.Append("")}}
+	others := []symbol{}
+	for i, sym := range t.symbols {
+		value := sym.Value
+		if t.elfType() == elf.ET_REL && placed[i] >= 0 {
+			value -= sections[placed[i]].Addr
+		}
+
+		shndx := sym.Section
+		if sym.Section == 0 {
+			shndx = uint16(1)
+			if placed[i] > 0 {
+				shndx = uint16(baseSections + placed[i] - 1)
+			}
+		}
+
+		entry := symbol{
+			name:  table.strtab.Append(sym.Name),
+			value: value,
+			size:  sym.Size,
+			info:  elf.ST_INFO(sym.Bind, sym.Type),
+			other: uint8(sym.Visibility) & 0x3,
+			shndx: shndx,
+		}
+
+		if sym.Bind == elf.STB_LOCAL {
+			locals = append(locals, entry)
+		} else {
+			others = append(others, entry)
+		}
+	}
+
+	table.symbols = append(locals, others...)
+	table.firstGlobal = uint32(len(locals))
+
+	return sections[0], sections[1:], table
+}
 
-		return nil
+// assignSections returns copies of .text and added sections with index of section of every symbol, -1 for special ones.
+func (t *TinyELF) assignSections() ([]*Section, []int) {
+	sections := []*Section{}
+	for _, s := range append([]*Section{t.text}, t.sections...) {
+		c := *s
+		if c.Flags&elf.SHF_ALLOC != 0 && len(c.Data) == 0 {
+			c.Type = elf.SHT_NOBITS
+		}
+		sections = append(sections, &c)
 	}
 
-	return ErrNoELF
+	placed := make([]int, len(t.symbols))
+	data := -1
+	for i, sym := range t.symbols {
+		if sym.Section != 0 {
+			placed[i] = slot(sym.Section, len(sections))
+			continue
+		}
+
+		placed[i] = place(sections, sym)
+
+		if placed[i] < 0 && sym.Type == elf.STT_FUNC {
+			placed[i] = 0
+		}
+
+		if placed[i] < 0 {
+			if data < 0 {
+				sections = append(sections, &Section{Name: ".data", Type: elf.SHT_NOBITS, Flags: elf.SHF_ALLOC | elf.SHF_WRITE, Addralign: 8})
+				data = len(sections) - 1
+			}
+			placed[i] = data
+		}
+	}
+
+	return sections, placed
+}
+
+// slot returns position of section with ELF index shndx in sections starting with .text, -1 if there is none.
+func slot(shndx uint16, n int) int {
+	switch {
+	case shndx == 1:
+		return 0
+	case shndx >= baseSections && int(shndx-baseSections)+1 < n:
+		return int(shndx-baseSections) + 1
+	}
+
+	return -1
+}
+
+// place returns index of allocated section containing symbol, preferring executable ones for functions.
+func place(sections []*Section, sym *Symbol) int {
+	exec := sym.Type == elf.STT_FUNC
+	found := -1
+	for i, s := range sections {
+		if !s.contains(sym.Value) {
+			continue
+		}
+
+		if (s.Flags&elf.SHF_EXECINSTR != 0) == exec {
+			return i
+		}
+
+		if found < 0 {
+			found = i
+		}
+	}
+
+	return found
+}
+
+// padAddr pads buf so that off is congruent to addr modulo align, as required for PT_LOAD.
+func padAddr(buf *bytes.Buffer, off uint64, addr uint64, align uint64) uint64 {
+	n := (addr%align + align - off%align) % align
+	buf.Write(make([]byte, n))
+
+	return off + n
+}
+
+func pad(buf *bytes.Buffer, off uint64, align uint64) uint64 {
+	if align <= 1 {
+		return off
+	}
+
+	n := (align - off%align) % align
+	buf.Write(make([]byte, n))
+
+	return off + n
+}
+
+func (e *elf32) write(w *bytes.Buffer, text *Section, symbols *symbolTable, extra []*Section, segments []*Segment) {
+	header := e.Header
+	sections := append([]elf.Section32{}, e.Sections...)
+	shstrtab := StrTab(append([]byte{}, e.ShStrTab...))
+
+	symtab := &bytes.Buffer{}
+	for _, s := range symbols.symbols {
+		binary.Write(symtab, e.byteOrder, elf.Sym32{
+			Name:  s.name,
+			Value: uint32(s.value),
+			Size:  uint32(s.size),
+			Info:  s.info,
+			Other: s.other,
+			Shndx: s.shndx,
+		})
+	}
+
+	if len(segments) > 0 {
+		header.Phoff = uint32(header.Ehsize)
+		header.Phentsize = 32
+		header.Phnum = uint16(len(segments))
+		sections[2].Off = header.Phoff + uint32(len(segments))*32
+	}
+
+	sections[2].Info = symbols.firstGlobal
+	sections[2].Size = uint32(symtab.Len())
+	sections[3].Off = sections[2].Off + sections[2].Size
+	sections[3].Size = uint32(len(symbols.strtab))
+	sections[4].Off = sections[3].Off + sections[3].Size
+
+	// .text keeps its place and name
+	all := append([]*Section{text}, extra...)
+	names := make([]uint32, len(all))
+	names[0] = sections[1].Name
+	for i, s := range extra {
+		names[i+1] = shstrtab.Append(s.Name)
+	}
+	sections[4].Size = uint32(len(shstrtab))
+
+	body := &bytes.Buffer{}
+	off := uint64(sections[4].Off + sections[4].Size)
+	segOffs := make([]uint64, len(segments))
+	progs := []elf.Prog32{}
+	for i, seg := range segments {
+		off = padAddr(body, off, seg.Addr, seg.align())
+		segOffs[i] = off
+		progs = append(progs, elf.Prog32{
+			Type:   uint32(elf.PT_LOAD),
+			Flags:  uint32(seg.Flags),
+			Off:    uint32(off),
+			Vaddr:  uint32(seg.Addr),
+			Paddr:  uint32(seg.Addr),
+			Filesz: uint32(len(seg.Data)),
+			Memsz:  uint32(seg.memSize()),
+			Align:  uint32(seg.align()),
+		})
+		body.Write(seg.Data)
+		off += uint64(len(seg.Data))
+	}
+
+	for i, s := range all {
+		segment, segOff := inSegment(segments, s)
+		if segment < 0 {
+			off = pad(body, off, s.Addralign)
+		}
+
+		section := elf.Section32{
+			Name:      names[i],
+			Type:      uint32(s.Type),
+			Flags:     uint32(s.Flags),
+			Addr:      uint32(s.Addr),
+			Off:       uint32(off),
+			Size:      uint32(s.size()),
+			Link:      s.Link,
+			Info:      s.Info,
+			Addralign: uint32(s.Addralign),
+			Entsize:   uint32(s.Entsize),
+		}
+
+		if segment >= 0 {
+			section.Off = uint32(segOffs[segment] + segOff)
+		}
+
+		if i == 0 {
+			sections[1] = section
+		} else {
+			sections = append(sections, section)
+		}
+
+		if s.Type != elf.SHT_NOBITS && segment < 0 {
+			body.Write(s.Data)
+			off += uint64(len(s.Data))
+		}
+	}
+	off = pad(body, off, 4)
+
+	header.Shoff = uint32(off)
+	header.Shnum = uint16(len(sections))
+
+	binary.Write(w, e.byteOrder, header)
+	binary.Write(w, e.byteOrder, progs)
+	binary.Write(w, e.byteOrder, symtab.Bytes())
+	binary.Write(w, e.byteOrder, symbols.strtab)
+	binary.Write(w, e.byteOrder, shstrtab)
+	binary.Write(w, e.byteOrder, body.Bytes())
+	binary.Write(w, e.byteOrder, sections)
+}
+
+func (e *elf64) write(w *bytes.Buffer, text *Section, symbols *symbolTable, extra []*Section, segments []*Segment) {
+	header := e.Header
+	sections := append([]elf.Section64{}, e.Sections...)
+	shstrtab := StrTab(append([]byte{}, e.ShStrTab...))
+
+	symtab := &bytes.Buffer{}
+	for _, s := range symbols.symbols {
+		binary.Write(symtab, e.byteOrder, elf.Sym64{
+			Name:  s.name,
+			Value: s.value,
+			Size:  s.size,
+			Info:  s.info,
+			Other: s.other,
+			Shndx: s.shndx,
+		})
+	}
+
+	if len(segments) > 0 {
+		header.Phoff = uint64(header.Ehsize)
+		header.Phentsize = 56
+		header.Phnum = uint16(len(segments))
+		sections[2].Off = header.Phoff + uint64(len(segments))*56
+	}
+
+	sections[2].Info = symbols.firstGlobal
+	sections[2].Size = uint64(symtab.Len())
+	sections[3].Off = sections[2].Off + sections[2].Size
+	sections[3].Size = uint64(len(symbols.strtab))
+	sections[4].Off = sections[3].Off + sections[3].Size
+
+	// .text keeps its place and name
+	all := append([]*Section{text}, extra...)
+	names := make([]uint32, len(all))
+	names[0] = sections[1].Name
+	for i, s := range extra {
+		names[i+1] = shstrtab.Append(s.Name)
+	}
+	sections[4].Size = uint64(len(shstrtab))
+
+	body := &bytes.Buffer{}
+	off := sections[4].Off + sections[4].Size
+	segOffs := make([]uint64, len(segments))
+	progs := []elf.Prog64{}
+	for i, seg := range segments {
+		off = padAddr(body, off, seg.Addr, seg.align())
+		segOffs[i] = off
+		progs = append(progs, elf.Prog64{
+			Type:   uint32(elf.PT_LOAD),
+			Flags:  uint32(seg.Flags),
+			Off:    off,
+			Vaddr:  seg.Addr,
+			Paddr:  seg.Addr,
+			Filesz: uint64(len(seg.Data)),
+			Memsz:  seg.memSize(),
+			Align:  seg.align(),
+		})
+		body.Write(seg.Data)
+		off += uint64(len(seg.Data))
+	}
+
+	for i, s := range all {
+		segment, segOff := inSegment(segments, s)
+		if segment < 0 {
+			off = pad(body, off, s.Addralign)
+		}
+
+		section := elf.Section64{
+			Name:      names[i],
+			Type:      uint32(s.Type),
+			Flags:     uint64(s.Flags),
+			Addr:      s.Addr,
+			Off:       off,
+			Size:      s.size(),
+			Link:      s.Link,
+			Info:      s.Info,
+			Addralign: s.Addralign,
+			Entsize:   s.Entsize,
+		}
+
+		if segment >= 0 {
+			section.Off = segOffs[segment] + segOff
+		}
+
+		if i == 0 {
+			sections[1] = section
+		} else {
+			sections = append(sections, section)
+		}
+
+		if s.Type != elf.SHT_NOBITS && segment < 0 {
+			body.Write(s.Data)
+			off += uint64(len(s.Data))
+		}
+	}
+	off = pad(body, off, 8)
+
+	header.Shoff = off
+	header.Shnum = uint16(len(sections))
+
+	binary.Write(w, e.byteOrder, header)
+	binary.Write(w, e.byteOrder, progs)
+	binary.Write(w, e.byteOrder, symtab.Bytes())
+	binary.Write(w, e.byteOrder, symbols.strtab)
+	binary.Write(w, e.byteOrder, shstrtab)
+	binary.Write(w, e.byteOrder, body.Bytes())
+	binary.Write(w, e.byteOrder, sections)
 }
@@ -0,0 +1,186 @@
+package tinyelf
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"slices"
+	"testing"
+)
+
+// parse writes t and reads it back.
+func parse(t *testing.T, e *TinyELF) *elf.File {
+	data, err := e.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+// symbols returns symbols of f by name.
+func symbols(t *testing.T, f *elf.File) map[string]elf.Symbol {
+	list, err := f.Symbols()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := map[string]elf.Symbol{}
+	for _, s := range list {
+		result[s.Name] = s
+	}
+
+	return result
+}
+
+func TestSectionRelativeValues(t *testing.T) {
+	type want struct {
+		value   uint64
+		section string
+	}
+
+	tests := []struct {
+		typ  elf.Type
+		want map[string]want
+	}{
+		// values are relative to sections, .text starts at image base
+		{elf.ET_REL, map[string]want{
+			"main":    {0x10, ".text"},
+			"counter": {0x10, ".bss"},
+			"far":     {0, ".data"},
+		}},
+		{elf.ET_EXEC, map[string]want{
+			"main":    {0x1010, ".text"},
+			"counter": {0x2010, ".bss"},
+			"far":     {0x5000, ".data"},
+		}},
+	}
+
+	for _, tt := range tests {
+		e := New64("", elf.EM_X86_64, 0, binary.LittleEndian, uint(tt.typ))
+		e.Rebase(0x1000, 0)
+		e.AddSection(&Section{Name: ".bss", Type: elf.SHT_NOBITS, Flags: elf.SHF_ALLOC | elf.SHF_WRITE, Addr: 0x2000, Size: 0x100, Addralign: 8})
+		e.AddSymbol("main", 0x1010, 0x20, elf.STT_FUNC)
+		e.AddSymbol("counter", 0x2010, 8, elf.STT_OBJECT)
+		// outside of any section, goes to new .data
+		e.AddSymbol("far", 0x5000, 4, elf.STT_OBJECT)
+
+		f := parse(t, e)
+		syms := symbols(t, f)
+		for name, w := range tt.want {
+			s := syms[name]
+			if s.Value != w.value || int(s.Section) >= len(f.Sections) || f.Sections[s.Section].Name != w.section {
+				t.Errorf("%s %s: got 0x%x in section %d, want 0x%x in %s", tt.typ, name, s.Value, s.Section, w.value, w.section)
+			}
+		}
+
+		// NOBITS sections cover their symbols, existing extent is kept
+		covers := map[string][2]uint64{".bss": {0x2000, 0x100}, ".data": {0x5000, 4}}
+		if tt.typ == elf.ET_EXEC {
+			covers[".text"] = [2]uint64{0x1010, 0x20}
+		} else {
+			covers[".text"] = [2]uint64{0x1000, 0x30}
+		}
+
+		for name, c := range covers {
+			s := f.Section(name)
+			if s == nil || s.Type != elf.SHT_NOBITS || s.Addr != c[0] || s.Size != c[1] {
+				t.Errorf("%s %s: got %+v, want addr 0x%x size 0x%x", tt.typ, name, s, c[0], c[1])
+			}
+		}
+	}
+}
+
+func TestCover(t *testing.T) {
+	s := &Section{Type: elf.SHT_NOBITS}
+	s.cover(0x100, 0x110)
+	s.cover(0x80, 0x90)
+	s.cover(0x120, 0x130)
+	if s.Addr != 0x80 || s.Size != 0xb0 {
+		t.Errorf("got addr 0x%x size 0x%x", s.Addr, s.Size)
+	}
+
+	progbits := &Section{Type: elf.SHT_PROGBITS, Addr: 0x100, Data: make([]byte, 4)}
+	progbits.cover(0, 0x1000)
+	if progbits.Addr != 0x100 || progbits.size() != 4 {
+		t.Errorf("PROGBITS section is resized: %+v", progbits)
+	}
+}
+
+func TestSymbolOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		symbols []*Symbol
+		// names in .symtab order without null symbol
+		order       []string
+		firstGlobal uint32
+	}{
+		{"locals first", []*Symbol{
+			{Name: "g1", Value: 0x1000, Type: elf.STT_FUNC, Bind: elf.STB_GLOBAL},
+			{Name: "l1", Value: 0x1010, Type: elf.STT_FUNC, Bind: elf.STB_LOCAL},
+			{Name: "w1", Value: 0x1020, Type: elf.STT_FUNC, Bind: elf.STB_WEAK},
+			{Name: "l2", Value: 0x1030, Type: elf.STT_OBJECT, Bind: elf.STB_LOCAL},
+		}, []string{"l1", "l2", "g1", "w1"}, 3},
+		{"no locals", []*Symbol{
+			{Name: "g1", Value: 0x1000, Type: elf.STT_FUNC, Bind: elf.STB_GLOBAL},
+		}, []string{"g1"}, 1},
+		{"only locals", []*Symbol{
+			{Name: "l1", Value: 0x1000, Type: elf.STT_FUNC, Bind: elf.STB_LOCAL},
+			{Name: "l2", Value: 0x1010, Type: elf.STT_FUNC, Bind: elf.STB_LOCAL},
+		}, []string{"l1", "l2"}, 3},
+	}
+
+	for _, class := range []elf.Class{elf.ELFCLASS32, elf.ELFCLASS64} {
+		for _, tt := range tests {
+			var e *TinyELF
+			if class == elf.ELFCLASS32 {
+				e = New32("", elf.EM_ARM, 0, binary.LittleEndian, uint(elf.ET_EXEC))
+			} else {
+				e = New64("", elf.EM_X86_64, 0, binary.LittleEndian, uint(elf.ET_EXEC))
+			}
+
+			for _, s := range tt.symbols {
+				e.AddSymbolEntry(s)
+			}
+
+			f := parse(t, e)
+			list, err := f.Symbols()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			names := []string{}
+			for _, s := range list {
+				names = append(names, s.Name)
+			}
+
+			if !slices.Equal(names, tt.order) {
+				t.Errorf("%s %s: got order %v, want %v", class, tt.name, names, tt.order)
+			}
+
+			if info := f.Section(".symtab").Info; info != tt.firstGlobal {
+				t.Errorf("%s %s: got sh_info %d, want %d", class, tt.name, info, tt.firstGlobal)
+			}
+		}
+	}
+}
+
+func TestSymbolAttributes(t *testing.T) {
+	e := New64("", elf.EM_X86_64, 0, binary.LittleEndian, uint(elf.ET_EXEC))
+	e.AddSymbolEntry(&Symbol{Name: "hidden", Value: 0x1000, Size: 4, Type: elf.STT_FUNC, Bind: elf.STB_GLOBAL, Visibility: elf.STV_HIDDEN})
+	e.AddSymbolEntry(&Symbol{Name: "abs", Value: 0x42, Type: elf.STT_NOTYPE, Bind: elf.STB_GLOBAL, Section: uint16(elf.SHN_ABS)})
+
+	syms := symbols(t, parse(t, e))
+	if s := syms["hidden"]; elf.ST_VISIBILITY(s.Other) != elf.STV_HIDDEN || elf.ST_BIND(s.Info) != elf.STB_GLOBAL {
+		t.Errorf("hidden: got %+v", s)
+	}
+
+	if s := syms["abs"]; s.Section != elf.SHN_ABS || s.Value != 0x42 {
+		t.Errorf("abs: got %+v", s)
+	}
+}